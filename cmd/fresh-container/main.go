@@ -36,9 +36,18 @@ func main() {
 				Usage: "Check if the specified image is stale",
 				Description: `Given a user defined expiration rule checks if the specified container is stale.
 
-The image tags - both the current one and the remote ones - must respect semantic versioning (https://semver.org/).
+The image tags - both the current one and the remote ones - must respect semantic versioning (https://semver.org/),
+unless another version scheme is selected using the '--scheme' flag:
 
-The expiration constraint must be formulated to be understood by https://github.com/blang/semver#ranges
+  * 'calver': calendar versions like '2024.01', '2024.01.15' or '22.04'
+  * 'numeric': any number of numeric components, like '1.2.3.4'
+  * 'date': date stamps like '20240115', '2024-01-15' or '20240115-103000'
+
+The constraints of these schemes use the operators listed below, the versions
+are expressed using the scheme: '>= 2024.01 < 2025.01'.
+
+The expiration constraint follows the syntax of https://github.com/blang/semver#ranges, extended
+with the npm and Cargo one.
 
 A condition is composed of an operator and a version. The supported operators are:
 
@@ -60,24 +69,76 @@ Ranges can also be linked by logical OR:
 
   *  '<2.0.0 || >=3.0.0' would match 1.x.x and 3.x.x but not 2.x.x
 
-AND has a higher precedence than OR. It's not possible to use brackets.
+AND has a higher precedence than OR, parentheses can be used to group ranges.
 
 Ranges can be combined by both AND and OR
 
   *  '>1.0.0 <2.0.0 || >3.0.0 !4.2.1' would match 1.2.3, 1.9.9, 3.1.1, but not 4.2.1, 2.1.1
 
+The npm and Cargo shorthands are supported too:
+
+  * '^1.9' Compatible versions, same as '>=1.9.0 <2.0.0'
+  * '~1.9.0' Patch releases, same as '>=1.9.0 <1.10.0'
+  * '1.9.x', '1.9.*', '1.9' Wildcards, same as '>=1.9.0 <1.10.0'
+  * '1.9.0 - 1.10.0' Hyphen ranges, same as '>=1.9.0 <=1.10.0'
+  * '>=1.9, <2' Comparisons can be separated by commas
+
 Example:
 
 $ fresh-container check --constraint ">= 1.5.0 < 1.6.0" "influxdb:1.5.0"
+
+Instead of writing a constraint, an update policy can derive it from the
+current tag: 'patch', 'minor', 'major' or 'any'. The derived constraint is
+reported together with the evaluation:
+
+$ fresh-container check --policy patch "influxdb:1.5.0"
+
+Images stored on the local filesystem, inside of OCI image layouts or tarballs
+created by 'docker save', can be checked without reaching any registry:
+
+$ fresh-container check --constraint ">= 1.2.0" "oci:/path/to/layout:app:1.2.3"
+$ fresh-container check --constraint ">= 1.2.0" "docker-archive:/path/to/app.tar:app:1.2.3"
+
+Floating tags, like 'latest' or '1.21', can be checked using the digest mode.
+The digest of the image being used is compared with the one the registry
+currently associates with the tag. The digest is taken either from the image
+reference or from a lock file:
+
+$ fresh-container check --digest "nginx:1.21@sha256:<digest>"
+$ fresh-container check --digest --lock-file images.lock "redis:latest"
 `,
-				UsageText: "fresh-container check --constraint <FRESH_CONTAINER_CONSTRAINT> <IMAGE>",
+				UsageText: "fresh-container check [--constraint <FRESH_CONTAINER_CONSTRAINT> | --policy <POLICY> | --digest] <IMAGE>",
 				Action:    cmd.CheckImage,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "constraint",
-						Usage:    "Expiration constraint - must follow semver rules",
-						EnvVars:  []string{"FRESH_CONTAINER_CHECK_CONSTRAINT"},
-						Required: true,
+						Name:    "constraint",
+						Usage:   "Expiration constraint - must follow semver rules. Required unless the digest mode or a policy is used",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_CONSTRAINT"},
+					},
+					&cli.StringFlag{
+						Name:    "policy",
+						Usage:   "Derive the constraint from the current tag (patch, minor, major, any), e.g. patch allows >=1.9.3 <1.10.0 for 1.9.3. Cannot be used together with the constraint flag",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_POLICY"},
+					},
+					&cli.StringFlag{
+						Name:    "strategy",
+						Usage:   "Version recommended among the ones satisfying the constraint (latest, nearest, next-minor-latest-patch). Defaults to latest",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_STRATEGY"},
+					},
+					&cli.BoolFlag{
+						Name:    "explain",
+						Usage:   "Report why each tag has been recommended or rejected",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_EXPLAIN"},
+					},
+					&cli.StringFlag{
+						Name:    "fail-on",
+						Usage:   "Only fail when the lag of the image exceeds one of these comma separated thresholds, using the releases, majors, minors and patches metrics (e.g. majors>0,minors>2)",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_FAIL_ON"},
+					},
+					&cli.StringSliceFlag{
+						Name:    "exclude",
+						Usage:   "Never recommend the tags matching this version (1.2.4), glob pattern (1.4.*) or regular expression enclosed by slashes (/-rc\\d+$/), can be repeated. Added to the ones set inside of the configuration",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_EXCLUDE"},
 					},
 					&cli.StringFlag{
 						Name:    "server",
@@ -97,6 +158,105 @@ $ fresh-container check --constraint ">= 1.5.0 < 1.6.0" "influxdb:1.5.0"
 						Usage:   "Tag Prefix: use if the version tags from the repository have a prefix before the versioning infomation, i.e for Ubuntu-2021.10.3 use Ubuntu- as a tag prefix.  Only tags starting with the specificed prefix will be considered",
 						EnvVars: []string{"FRESH_CONTAINER_TAG_PREFIX"},
 					},
+					&cli.StringFlag{
+						Name:    "tag-pattern",
+						Usage:   "Regular expression extracting the version out of the tags using the major, minor, patch, pre and variant named groups, e.g. (?P<major>\\d+)\\.(?P<minor>\\d+)\\.(?P<patch>\\d+)-(?P<variant>alpine.*). Only the tags matching it, and sharing the variant of the current tag, will be considered",
+						EnvVars: []string{"FRESH_CONTAINER_TAG_PATTERN"},
+					},
+					&cli.BoolFlag{
+						Name:    "loose",
+						Usage:   "Coerce tags like v1.2.3, 1.21 or 3 into semver versions. The next version is reported using the name of its tag",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_LOOSE"},
+					},
+					&cli.StringFlag{
+						Name:    "scheme",
+						Usage:   "Version scheme followed by the tags (semver, calver, numeric, date). Overrides the value set inside of the configuration",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_SCHEME"},
+					},
+					&cli.StringFlag{
+						Name:    "platform",
+						Usage:   "Only consider the tags publishing an image for the given platform, expressed as os/arch[/variant] (e.g. linux/arm64)",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_PLATFORM"},
+					},
+					&cli.StringFlag{
+						Name:    "max-age",
+						Usage:   "Consider the image stale when its tag has been built longer than this ago, even if no newer tag exists (e.g. 90d, 12w, 1y)",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_MAX_AGE"},
+					},
+					&cli.StringFlag{
+						Name:    "min-release-age",
+						Usage:   "Do not recommend tags built more recently than this (e.g. 72h, 7d). Overrides the value set inside of the configuration",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_MIN_RELEASE_AGE"},
+					},
+					&cli.BoolFlag{
+						Name:    "digest",
+						Usage:   "Digest mode: the image is stale when the digest published by the registry for its tag differs from the one being used. The tag doesn't have to follow semver",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_DIGEST"},
+					},
+					&cli.StringFlag{
+						Name:    "lock-file",
+						Usage:   "Digest mode: json file holding the digests of the images being used. Images not referenced by digest are looked up there, missing entries are added",
+						EnvVars: []string{"FRESH_CONTAINER_CHECK_LOCK_FILE"},
+					},
+				},
+			},
+			{
+				Name:  "scan-registry",
+				Usage: "Report the repositories of a registry whose newest tag breaks the policy",
+				Description: `Enumerates all the repositories of the registry using its catalog and looks
+for the highest semver tag of each one of them.
+
+The repositories without any tag following semantic versioning are reported.
+When the '--max-age' flag is used, the repositories whose newest tag has been
+built longer than that ago are reported too.
+
+The repositories to scan can be selected using glob patterns, where '*' does
+not match the '/' separator:
+
+$ fresh-container scan-registry --include "team/*" --exclude "team/tmp-*" --max-age 180d registry.local.lan
+
+The command fails when a repository breaks the policy or cannot be scanned.
+`,
+				UsageText: "fresh-container scan-registry [--include <PATTERN>] [--exclude <PATTERN>] [--max-age <AGE>] <REGISTRY>",
+				Action:    cmd.ScanRegistry,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "include",
+						Usage:   "Only scan the repositories matching this glob pattern, can be repeated",
+						EnvVars: []string{"FRESH_CONTAINER_SCAN_INCLUDE"},
+					},
+					&cli.StringSliceFlag{
+						Name:    "exclude",
+						Usage:   "Do not scan the repositories matching this glob pattern, can be repeated",
+						EnvVars: []string{"FRESH_CONTAINER_SCAN_EXCLUDE"},
+					},
+					&cli.StringFlag{
+						Name:    "max-age",
+						Usage:   "Report the repositories whose newest tag has been built longer than this ago (e.g. 180d, 26w, 1y)",
+						EnvVars: []string{"FRESH_CONTAINER_SCAN_MAX_AGE"},
+					},
+					&cli.StringFlag{
+						Name:    "tagPrefix",
+						Usage:   "Tag Prefix: only the tags starting with the specified prefix will be considered",
+						EnvVars: []string{"FRESH_CONTAINER_TAG_PREFIX"},
+					},
+					&cli.BoolFlag{
+						Name:    "loose",
+						Usage:   "Coerce tags like v1.2.3, 1.21 or 3 into semver versions",
+						EnvVars: []string{"FRESH_CONTAINER_SCAN_LOOSE"},
+					},
+					&cli.StringFlag{
+						Name:    "scheme",
+						Usage:   "Version scheme followed by the tags (semver, calver, numeric, date). Overrides the value set inside of the configuration",
+						EnvVars: []string{"FRESH_CONTAINER_SCAN_SCHEME"},
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Output format (json,text)",
+						EnvVars: []string{"FRESH_CONTAINER_SCAN_OUTPUT"},
+						Value:   "text",
+					},
 				},
 			},
 			{
@@ -4,35 +4,111 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
-	"github.com/blang/semver"
 	"github.com/flavio/fresh-container/pkg/fresh_container"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
 
 func (a *ApiServer) Check(w http.ResponseWriter, r *http.Request) {
+	var err error
 	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	request := fresh_container.ImageUpgradeEvaluationRequest{
+		Image:         vars["image"],
+		Constraint:    query.Get("constraint"),
+		Policy:        query.Get("policy"),
+		TagPrefix:     query.Get("tagPrefix"),
+		TagPattern:    query.Get("tagPattern"),
+		Scheme:        query.Get("scheme"),
+		Strategy:      query.Get("strategy"),
+		Exclude:       query["exclude"],
+		Platform:      query.Get("platform"),
+		MaxAge:        query.Get("maxAge"),
+		MinReleaseAge: query.Get("minReleaseAge"),
+	}
+	if query.Get("digest") != "" {
+		request.Digest, err = strconv.ParseBool(query.Get("digest"))
+		if err != nil {
+			ServeErrorAsJSON(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if query.Get("explain") != "" {
+		request.Explain, err = strconv.ParseBool(query.Get("explain"))
+		if err != nil {
+			ServeErrorAsJSON(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if query.Get("loose") != "" {
+		request.Loose, err = strconv.ParseBool(query.Get("loose"))
+		if err != nil {
+			ServeErrorAsJSON(w, http.StatusBadRequest, err)
+			return
+		}
+	}
 
 	log.WithFields(log.Fields{
-		"image":      vars["image"],
-		"constraint": vars["constraint"],
-		"tagPrefix":  vars["tagPrefix"],
-		"host":       r.Host,
+		"image":         request.Image,
+		"constraint":    request.Constraint,
+		"policy":        request.Policy,
+		"tagPrefix":     request.TagPrefix,
+		"tagPattern":    request.TagPattern,
+		"loose":         request.Loose,
+		"scheme":        request.Scheme,
+		"strategy":      request.Strategy,
+		"explain":       request.Explain,
+		"exclude":       request.Exclude,
+		"digest":        request.Digest,
+		"platform":      request.Platform,
+		"maxAge":        request.MaxAge,
+		"minReleaseAge": request.MinReleaseAge,
+		"host":          r.Host,
 	}).Debug("GET check")
 
-	image, err := fresh_container.NewImage(vars["image"], vars["tagPrefix"])
+	if fresh_container.IsLocalReference(request.Image) {
+		err = fmt.Errorf("Images stored on the local filesystem can only be checked by local evaluations")
+		ServeErrorAsJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = request.Validate(); err != nil {
+		ServeErrorAsJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if request.Digest {
+		a.checkDigest(w, request)
+		return
+	}
+
+	image, err := fresh_container.NewImageFromRequest(request, a.cfg)
+	if err != nil {
+		ServeErrorAsJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	constraint, err := image.RequestConstraint(request)
 	if err != nil {
 		ServeErrorAsJSON(w, http.StatusBadRequest, err)
 		return
 	}
 
-	_, err = semver.ParseRange(vars["constraint"])
+	_, err = image.ParseConstraint(constraint)
 	if err != nil {
 		ServeErrorAsJSON(w, http.StatusBadRequest, err)
 		return
 	}
 
+	if request.NeedsRegistry() || image.MinReleaseAge(a.cfg, request) != "" {
+		// The manifests of the tags have to be inspected - queue the job
+		a.queueJob(w, request)
+		return
+	}
+
 	tags, err := a.db.GetImageTags(image)
 	if err != nil {
 		ServeErrorAsJSON(w, http.StatusInternalServerError, err)
@@ -41,13 +117,7 @@ func (a *ApiServer) Check(w http.ResponseWriter, r *http.Request) {
 
 	if len(tags) == 0 {
 		// No tags - queue the job
-		id, err := a.backgroundWorker.AddJob(vars["image"], vars["constraint"], vars["tagPrefix"])
-		if err != nil {
-			ServeErrorAsJSON(w, http.StatusInternalServerError, err)
-			return
-		}
-
-		serveJobAcceptedResponse(id, w)
+		a.queueJob(w, request)
 		return
 	}
 
@@ -56,12 +126,60 @@ func (a *ApiServer) Check(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	evaluation, err := image.EvalUpgrade(vars["constraint"])
-	if err = image.SetTagVersions(tags, true); err != nil {
+	evaluation, err := image.Evaluate(r.Context(), a.cfg, request)
+	if err != nil {
+		ServeErrorAsJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	serveEvaluation(evaluation, w)
+}
+
+func (a *ApiServer) checkDigest(w http.ResponseWriter, request fresh_container.ImageUpgradeEvaluationRequest) {
+	image, err := fresh_container.NewDigestImage(request.Image, a.cfg)
+	if err != nil {
+		ServeErrorAsJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if image.Digest == "" {
+		err = fmt.Errorf("The image must be referenced by tag and digest (image:tag@sha256:...) when the digest mode is used")
+		ServeErrorAsJSON(w, http.StatusBadRequest, err)
+		return
+	}
+
+	image.TagDigest, err = a.db.GetImageDigest(image)
+	if err != nil {
+		ServeErrorAsJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if image.TagDigest == "" {
+		// No digest - queue the job
+		a.queueJob(w, request)
+		return
+	}
+
+	evaluation, err := image.EvalDigestUpgrade()
+	if err != nil {
 		ServeErrorAsJSON(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	serveEvaluation(evaluation, w)
+}
+
+func (a *ApiServer) queueJob(w http.ResponseWriter, request fresh_container.ImageUpgradeEvaluationRequest) {
+	id, err := a.backgroundWorker.AddJob(request)
+	if err != nil {
+		ServeErrorAsJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	serveJobAcceptedResponse(id, w)
+}
+
+func serveEvaluation(evaluation fresh_container.ImageUpgradeEvaluationResponse, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(evaluation)
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+type CheckDigestTestCase struct {
+	Query url.Values
+}
+
+func TestCheckDigestInvalidRequest(t *testing.T) {
+	cfg := config.NewConfig()
+	// no worker nor database are needed, invalid requests are rejected upfront
+	a, err := NewApiServer(nil, nil, 0, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	testCases := []CheckDigestTestCase{
+		// the image has no tag
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx@" + digest}, "digest": {"true"}}},
+		// the image has no digest
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:latest"}, "digest": {"true"}}},
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:latest@" + digest}, "digest": {"maybe"}}},
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:latest@" + digest}, "digest": {"true"}, "policy": {"minor"}}},
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:latest@" + digest}, "digest": {"true"}, "platform": {"linux/amd64"}}},
+		// the same validation as the command line
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:1.21.0"}}},
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:1.21.0"}, "constraint": {"^1.21"}, "policy": {"minor"}}},
+		CheckDigestTestCase{Query: url.Values{"image": {"nginx:1.21.0"}, "constraint": {"^1.21"}, "scheme": {"romver"}}},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/api/v1/check?"+tc.Query.Encode(), nil)
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected response code for query %s, got %d: %s", tc.Query.Encode(), w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/flavio/fresh-container/internal/ratelimit"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetRateLimits returns the remaining request budget of the registries
+// that advertise a rate limit
+func (a *ApiServer) GetRateLimits(w http.ResponseWriter, r *http.Request) {
+	log.WithFields(log.Fields{
+		"host": r.Host,
+	}).Debug("GET ratelimits")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(ratelimit.Default.Status())
+}
@@ -44,22 +44,12 @@ func (a *ApiServer) ListenAndServe() error {
 }
 
 func (a *ApiServer) initRoutes() {
+	// Optional parameters are read straight from the query
 	a.router.
 		Path("/api/v1/check").
 		Methods("GET").
 		Queries(
 			"image", "{image}",
-			"constraint", "{constraint}",
-		).HandlerFunc(a.Check)
-
-	// Registering the handler twice seems to be the easiest way to have an option query
-	a.router.
-		Path("/api/v1/check").
-		Methods("GET").
-		Queries(
-			"image", "{image}",
-			"constraint", "{constraint}",
-			"tagPrefix", "{tagPrefix}",
 		).HandlerFunc(a.Check)
 
 	a.router.
@@ -72,6 +62,11 @@ func (a *ApiServer) initRoutes() {
 		Methods("GET").
 		HandlerFunc(a.GetEvaluation)
 
+	a.router.
+		Path("/api/v1/ratelimits").
+		Methods("GET").
+		HandlerFunc(a.GetRateLimits)
+
 	a.router.
 		Path("/healthz").
 		Methods("GET").
@@ -0,0 +1,125 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options describes how the TLS connections to a registry are established
+type Options struct {
+	// PEM bundle of additional certificate authorities
+	CAFile string
+	// PEM client certificate and key
+	CertFile string
+	KeyFile  string
+	// Directories following the `<dir>/<host>/` layout: `*.crt` files are
+	// certificate authorities, `*.cert` and `*.key` files are client
+	// certificates and keys sharing the same base name
+	Dirs []string
+	// Do not verify the certificate of the registry
+	Insecure bool
+}
+
+// TLSConfig builds the TLS configuration used to contact the given host.
+// A nil configuration is returned when the default one can be used.
+func TLSConfig(host string, opts Options) (*tls.Config, error) {
+	caFiles := []string{}
+	pairs := [][2]string{}
+
+	if opts.CAFile != "" {
+		caFiles = append(caFiles, opts.CAFile)
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		pairs = append(pairs, [2]string{opts.CertFile, opts.KeyFile})
+	}
+
+	for _, dir := range opts.Dirs {
+		dirCAs, dirPairs, err := readCertsDir(filepath.Join(dir, host))
+		if err != nil {
+			return nil, err
+		}
+		caFiles = append(caFiles, dirCAs...)
+		pairs = append(pairs, dirPairs...)
+	}
+
+	if len(caFiles) == 0 && len(pairs) == 0 && !opts.Insecure {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: opts.Insecure,
+	}
+
+	if len(caFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, caFile := range caFiles {
+			data, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("Cannot read CA file %s: %v", caFile, err)
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("No valid certificate found inside of CA file %s", caFile)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	for _, pair := range pairs {
+		cert, err := tls.LoadX509KeyPair(pair[0], pair[1])
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load client certificate %s: %v", pair[0], err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	return cfg, nil
+}
+
+// readCertsDir returns the certificate authorities and the client
+// certificates stored inside of the directory of a host. A missing
+// directory is not an error.
+func readCertsDir(dir string) ([]string, [][2]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, [][2]string{}, nil
+		}
+		return []string{}, [][2]string{}, err
+	}
+
+	caFiles := []string{}
+	pairs := [][2]string{}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".crt"):
+			caFiles = append(caFiles, filepath.Join(dir, name))
+		case strings.HasSuffix(name, ".cert"):
+			key := strings.TrimSuffix(name, ".cert") + ".key"
+			if !names[key] {
+				return []string{}, [][2]string{}, fmt.Errorf("Missing key %s for client certificate %s", key, filepath.Join(dir, name))
+			}
+			pairs = append(pairs, [2]string{filepath.Join(dir, name), filepath.Join(dir, key)})
+		case strings.HasSuffix(name, ".key"):
+			cert := strings.TrimSuffix(name, ".key") + ".cert"
+			if !names[cert] {
+				return []string{}, [][2]string{}, fmt.Errorf("Missing client certificate %s for key %s", cert, filepath.Join(dir, name))
+			}
+		}
+	}
+
+	return caFiles, pairs, nil
+}
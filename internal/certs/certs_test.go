@@ -0,0 +1,149 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newClientCertificate generates a self-signed client certificate,
+// returning its PEM encoded certificate and key
+func newClientCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fresh-container"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestTLSConfigDefault(t *testing.T) {
+	cfg, err := TLSConfig("registry.local.lan", Options{Dirs: []string{"/does/not/exist"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg != nil {
+		t.Errorf("Expected the default TLS configuration to be used")
+	}
+}
+
+func TestTLSConfigCertsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fresh-container-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, clientKey := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	writeFile(t, filepath.Join(dir, host, "ca.crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	// the client certificate is required by the server
+	cfg, err := TLSConfig(host, Options{Dirs: []string{dir}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	if _, err = client.Get(srv.URL); err == nil {
+		t.Errorf("Expected the request without client certificate to fail")
+	}
+
+	writeFile(t, filepath.Join(dir, host, "client.cert"), clientCert)
+	if _, err = TLSConfig(host, Options{Dirs: []string{dir}}); err == nil {
+		t.Errorf("Expected a failure because of the missing key")
+	}
+
+	writeFile(t, filepath.Join(dir, host, "client.key"), clientKey)
+	cfg, err = TLSConfig(host, Options{Dirs: []string{dir}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTLSConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fresh-container-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, clientKey := newClientCertificate(t)
+	writeFile(t, filepath.Join(dir, "client.pem"), clientCert)
+	writeFile(t, filepath.Join(dir, "client-key.pem"), clientKey)
+	writeFile(t, filepath.Join(dir, "invalid.pem"), []byte("not a certificate"))
+
+	cfg, err := TLSConfig("registry.local.lan", Options{
+		CAFile:   filepath.Join(dir, "client.pem"),
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.RootCAs == nil || len(cfg.Certificates) != 1 || cfg.InsecureSkipVerify {
+		t.Errorf("Unexpected TLS configuration %+v", cfg)
+	}
+
+	if _, err = TLSConfig("registry.local.lan", Options{CAFile: filepath.Join(dir, "invalid.pem")}); err == nil {
+		t.Errorf("Expected a failure because of the invalid CA file")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/flavio/fresh-container/internal/config"
@@ -30,13 +32,46 @@ func isOutputFormatValid(format string) bool {
 func CheckImage(c *cli.Context) error {
 	var err error
 	var evaluation fresh_container.ImageUpgradeEvaluationResponse
-	constraint := c.String("constraint")
-	tagPrefix := c.String("tagPrefix")
 
 	if c.NArg() != 1 {
 		return cli.NewExitError("Wrong usage", 1)
 	}
 
+	request := fresh_container.ImageUpgradeEvaluationRequest{
+		Image:         c.Args().Get(0),
+		Constraint:    c.String("constraint"),
+		Policy:        c.String("policy"),
+		TagPrefix:     c.String("tagPrefix"),
+		TagPattern:    c.String("tag-pattern"),
+		Loose:         c.Bool("loose"),
+		Scheme:        c.String("scheme"),
+		Strategy:      c.String("strategy"),
+		Explain:       c.Bool("explain"),
+		Exclude:       c.StringSlice("exclude"),
+		Digest:        c.Bool("digest"),
+		Platform:      c.String("platform"),
+		MaxAge:        c.String("max-age"),
+		MinReleaseAge: c.String("min-release-age"),
+	}
+	if err := request.Validate(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	var thresholds []fresh_container.LagThreshold
+	if c.String("fail-on") != "" {
+		if request.Digest {
+			return cli.NewExitError("The `fail-on` flag cannot be used together with the `digest` mode", 1)
+		}
+		if thresholds, err = fresh_container.ParseLagThresholds(c.String("fail-on")); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+	}
+	if fresh_container.IsLocalReference(request.Image) && c.String("server") != "" {
+		return cli.NewExitError("Images stored on the local filesystem cannot be checked by a remote server", 1)
+	}
+	if c.String("lock-file") != "" && (!request.Digest || c.String("server") != "") {
+		return cli.NewExitError("The `lock-file` flag can only be used by local evaluations done in `digest` mode", 1)
+	}
+
 	if c.Bool("debug") {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -52,10 +87,9 @@ func CheckImage(c *cli.Context) error {
 
 	if c.String("server") == "" {
 		evaluation, err = localEvaluation(
-			c.Args().Get(0),
-			constraint,
-			tagPrefix,
+			request,
 			c.String("config"),
+			c.String("lock-file"),
 			c.Context)
 	} else {
 		if c.String("config") != "" {
@@ -63,9 +97,7 @@ func CheckImage(c *cli.Context) error {
 		}
 		evaluation, err = remoteEvaluation(
 			c.String("server"),
-			c.Args().Get(0),
-			constraint,
-			tagPrefix,
+			request,
 			output != "json")
 	}
 	if err != nil {
@@ -74,6 +106,9 @@ func CheckImage(c *cli.Context) error {
 
 	switch output {
 	case "text":
+		if request.Digest {
+			return printDigestEvaluation(evaluation)
+		}
 		if !evaluation.Stale {
 			msg := fmt.Sprintf(
 				"%s is already the latest version available that satisfies the %s constraint",
@@ -82,7 +117,31 @@ func CheckImage(c *cli.Context) error {
 			if evaluation.TagPrefix != "" {
 				msg = fmt.Sprintf(" %s and the tag prefix %s", msg, evaluation.TagPrefix)
 			}
+			if evaluation.TagPattern != "" {
+				msg = fmt.Sprintf("%s and the tag pattern %s", msg, evaluation.TagPattern)
+			}
 			fmt.Println(msg)
+			printLatest(evaluation)
+			printExcluded(evaluation)
+			printPlatforms(evaluation)
+			printHeldBack(evaluation)
+			printCreationDates(evaluation)
+			printExplanation(evaluation)
+		} else if evaluation.MaxAgeExceeded && evaluation.NextVersion == strings.TrimPrefix(evaluation.CurrentVersion, evaluation.TagPrefix) {
+			// no newer tag, the image is stale only because of its age
+			err := fmt.Errorf(
+				"The '%s' container image tag '%s' was built on %s, longer than %s ago, and no newer tag satisfies the '%s' constraint.",
+				evaluation.Image,
+				evaluation.CurrentVersion,
+				evaluation.CurrentCreated.Format(time.RFC3339),
+				request.MaxAge,
+				evaluation.Constraint)
+			printLatest(evaluation)
+			printExcluded(evaluation)
+			printPlatforms(evaluation)
+			printHeldBack(evaluation)
+			printExplanation(evaluation)
+			return cli.NewExitError(err, 1)
 		} else {
 			err := fmt.Errorf(
 				"The '%s' container image can be upgraded from the '%s' tag to the '%s' one and still satisfy the '%s' constraint.",
@@ -90,6 +149,22 @@ func CheckImage(c *cli.Context) error {
 				evaluation.CurrentVersion,
 				evaluation.NextVersion,
 				evaluation.Constraint)
+			printFlavor(evaluation)
+			printLag(evaluation)
+			printLatest(evaluation)
+			printExcluded(evaluation)
+			printPlatforms(evaluation)
+			printHeldBack(evaluation)
+			printCreationDates(evaluation)
+			printExplanation(evaluation)
+			if len(thresholds) > 0 {
+				if _, exceeded := exceededThreshold(evaluation, thresholds); !exceeded {
+					// the upgrade is not urgent enough
+					fmt.Println(err)
+					return nil
+				}
+			}
+			// without thresholds any newer tag makes the check fail
 			return cli.NewExitError(err, 1)
 		}
 	case "json":
@@ -99,21 +174,167 @@ func CheckImage(c *cli.Context) error {
 		if err := encoder.Encode(evaluation); err != nil {
 			return cli.NewExitError(err, 1)
 		}
+		if threshold, exceeded := exceededThreshold(evaluation, thresholds); exceeded {
+			return cli.NewExitError(fmt.Sprintf("The lag of the image exceeds the %s threshold", threshold), 1)
+		}
 	}
 
 	return nil
 }
 
-func localEvaluation(image, constraint, tagPrefix, configFile string, ctx context.Context) (evaluation fresh_container.ImageUpgradeEvaluationResponse, err error) {
-	cfg := config.NewConfig()
-	if configFile != "" {
-		cfg, err = config.NewFromFile(configFile)
-		if err != nil {
-			return fresh_container.ImageUpgradeEvaluationResponse{}, err
+func printFlavor(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if evaluation.NextFlavor == "" {
+		return
+	}
+
+	fmt.Printf(
+		"The flavor of the image changes from '%s' to '%s'\n",
+		evaluation.CurrentFlavor,
+		evaluation.NextFlavor)
+}
+
+// exceededThreshold returns the first threshold exceeded by the lag
+// of the evaluation
+func exceededThreshold(evaluation fresh_container.ImageUpgradeEvaluationResponse, thresholds []fresh_container.LagThreshold) (fresh_container.LagThreshold, bool) {
+	if evaluation.Lag == nil {
+		return fresh_container.LagThreshold{}, false
+	}
+	for _, threshold := range thresholds {
+		if threshold.ExceededBy(*evaluation.Lag) {
+			return threshold, true
+		}
+	}
+	return fresh_container.LagThreshold{}, false
+}
+
+func printLag(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if evaluation.Lag == nil || evaluation.Lag.Releases == 0 {
+		return
+	}
+
+	fmt.Printf(
+		"The '%s' tag is %d releases behind: %d major, %d minor and %d patch releases\n",
+		evaluation.CurrentVersion,
+		evaluation.Lag.Releases,
+		evaluation.Lag.Majors,
+		evaluation.Lag.Minors,
+		evaluation.Lag.Patches)
+	if len(evaluation.Lag.Intermediate) > 0 {
+		fmt.Printf("Intermediate versions: %s\n", strings.Join(evaluation.Lag.Intermediate, ", "))
+	}
+}
+
+func printExcluded(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if len(evaluation.Excluded) == 0 {
+		return
+	}
+
+	fmt.Printf("Newer tags have been excluded: %s\n", strings.Join(evaluation.Excluded, ", "))
+}
+
+func printLatest(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if evaluation.LatestOverall == "" {
+		return
+	}
+
+	fmt.Printf(
+		"Latest versions: patch %s | minor %s | major %s | overall %s\n",
+		evaluation.LatestPatch,
+		evaluation.LatestMinor,
+		evaluation.LatestMajor,
+		evaluation.LatestOverall)
+}
+
+func printExplanation(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if len(evaluation.Explanation) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tVERDICT\tREASON")
+	for _, verdict := range evaluation.Explanation {
+		status := "rejected"
+		if verdict.Accepted {
+			status = "accepted"
 		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", verdict.Tag, status, verdict.Reason)
+	}
+	w.Flush()
+}
+
+func printPlatforms(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if evaluation.Platform == "" {
+		return
 	}
 
-	img, err := fresh_container.NewImage(image, tagPrefix)
+	tag := evaluation.CurrentVersion
+	if evaluation.Stale {
+		tag = evaluation.NextVersion
+	}
+	fmt.Printf(
+		"Only the tags publishing an image for the %s platform have been considered. The '%s' tag supports: %s\n",
+		evaluation.Platform,
+		tag,
+		strings.Join(evaluation.Platforms, ", "))
+}
+
+func printHeldBack(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	for _, held := range evaluation.HeldBack {
+		fmt.Printf(
+			"The '%s' tag has been held back: it was built on %s and becomes eligible on %s\n",
+			held.Tag,
+			held.Created.Format(time.RFC3339),
+			held.EligibleAt.Format(time.RFC3339))
+	}
+}
+
+func printCreationDates(evaluation fresh_container.ImageUpgradeEvaluationResponse) {
+	if evaluation.CurrentCreated != nil {
+		fmt.Printf("The '%s' tag was built on %s\n", evaluation.CurrentVersion, evaluation.CurrentCreated.Format(time.RFC3339))
+	}
+	if evaluation.Stale && evaluation.NextCreated != nil {
+		fmt.Printf("The '%s' tag was built on %s\n", evaluation.NextVersion, evaluation.NextCreated.Format(time.RFC3339))
+	}
+}
+
+func printDigestEvaluation(evaluation fresh_container.ImageUpgradeEvaluationResponse) error {
+	if !evaluation.Stale {
+		fmt.Printf(
+			"%s:%s is already using the latest digest available for its tag (%s)\n",
+			evaluation.Image,
+			evaluation.CurrentVersion,
+			evaluation.CurrentDigest)
+		return nil
+	}
+
+	err := fmt.Errorf(
+		"The '%s' container image tag '%s' has been updated: its digest changed from '%s' to '%s'.",
+		evaluation.Image,
+		evaluation.CurrentVersion,
+		evaluation.CurrentDigest,
+		evaluation.NextDigest)
+	return cli.NewExitError(err, 1)
+}
+
+func loadConfig(configFile string) (cfg config.Config, err error) {
+	if configFile == "" {
+		return config.NewConfig(), nil
+	}
+
+	return config.NewFromFile(configFile)
+}
+
+func localEvaluation(request fresh_container.ImageUpgradeEvaluationRequest, configFile, lockFile string, ctx context.Context) (evaluation fresh_container.ImageUpgradeEvaluationResponse, err error) {
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	if request.Digest {
+		return localDigestEvaluation(request, &cfg, lockFile, ctx)
+	}
+
+	img, err := fresh_container.NewImageFromRequest(request, &cfg)
 	if err != nil {
 		return fresh_container.ImageUpgradeEvaluationResponse{}, err
 	}
@@ -123,12 +344,61 @@ func localEvaluation(image, constraint, tagPrefix, configFile string, ctx contex
 		return fresh_container.ImageUpgradeEvaluationResponse{}, err
 	}
 
-	return img.EvalUpgrade(constraint)
+	return img.Evaluate(ctx, &cfg, request)
+}
+
+// localDigestEvaluation compares the digest of the image with the one
+// currently published by the registry. When the image reference does
+// not include a digest, the one recorded inside of the lock file is used.
+// Images missing from the lock file are added to it using the digest
+// published by the registry.
+func localDigestEvaluation(request fresh_container.ImageUpgradeEvaluationRequest, cfg *config.Config, lockFile string, ctx context.Context) (evaluation fresh_container.ImageUpgradeEvaluationResponse, err error) {
+	img, err := fresh_container.NewDigestImage(request.Image, cfg)
+	if err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	if img.Digest == "" && lockFile == "" {
+		return fresh_container.ImageUpgradeEvaluationResponse{},
+			fmt.Errorf("The image must be referenced by tag and digest (image:tag@sha256:...) unless a lock file is used")
+	}
+
+	if err = img.FetchDigest(ctx, cfg); err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	if img.Digest == "" {
+		lock, err := fresh_container.LoadDigestLock(lockFile)
+		if err != nil {
+			return fresh_container.ImageUpgradeEvaluationResponse{}, err
+		}
+
+		locked := lock.Get(img)
+		if locked == "" {
+			log.WithFields(log.Fields{
+				"image":  img.FullNameWithTag(),
+				"digest": img.TagDigest,
+				"lock":   lockFile,
+			}).Info("Adding image to the lock file")
+
+			locked = img.TagDigest
+			lock.Set(img, locked)
+			if err = lock.Save(); err != nil {
+				return fresh_container.ImageUpgradeEvaluationResponse{}, err
+			}
+		}
+
+		if err = img.SetDigest(locked); err != nil {
+			return fresh_container.ImageUpgradeEvaluationResponse{}, err
+		}
+	}
+
+	return img.EvalDigestUpgrade()
 }
 
-func remoteEvaluation(server, image, constraint, tagPrefix string, showProgress bool) (evaluation fresh_container.ImageUpgradeEvaluationResponse, err error) {
+func remoteEvaluation(server string, request fresh_container.ImageUpgradeEvaluationRequest, showProgress bool) (evaluation fresh_container.ImageUpgradeEvaluationResponse, err error) {
 	client := fresh_container.NewClient(server)
-	remoteEval, err := client.EvalUpgrade(image, constraint, tagPrefix)
+	remoteEval, err := client.EvalUpgrade(request)
 	if err != nil {
 		return fresh_container.ImageUpgradeEvaluationResponse{}, err
 	}
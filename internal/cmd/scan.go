@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/flavio/fresh-container/pkg/fresh_container"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+func ScanRegistry(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.NewExitError("Wrong usage", 1)
+	}
+
+	request := fresh_container.RegistryScanRequest{
+		Registry:  c.Args().Get(0),
+		Include:   c.StringSlice("include"),
+		Exclude:   c.StringSlice("exclude"),
+		TagPrefix: c.String("tagPrefix"),
+		Loose:     c.Bool("loose"),
+		Scheme:    c.String("scheme"),
+		MaxAge:    c.String("max-age"),
+	}
+	if err := request.Validate(); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if c.Bool("debug") {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	output := c.String("output")
+	if !isOutputFormatValid(output) {
+		err := fmt.Errorf(
+			"Invalid output format: %s. Valid ones are %+v",
+			output,
+			ValidOututFormats)
+		return cli.NewExitError(err, 1)
+	}
+
+	cfg, err := loadConfig(c.String("config"))
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	report, err := fresh_container.ScanRegistry(c.Context, &cfg, request)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	switch output {
+	case "text":
+		return printScanReport(report)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		if failed := report.Failed(); len(failed) > 0 {
+			// a partial scan must not pass
+			return cli.NewExitError(scanFailedError(report, failed), 1)
+		}
+	}
+
+	return nil
+}
+
+func scanFailedError(report fresh_container.RegistryScanReport, failed []fresh_container.RepositoryScanResult) error {
+	return fmt.Errorf(
+		"%d of the %d repositories of the %s registry could not be scanned.",
+		len(failed),
+		len(report.Repositories),
+		report.Registry)
+}
+
+func printScanReport(report fresh_container.RegistryScanReport) error {
+	failed := report.Failed()
+	for _, result := range failed {
+		fmt.Printf("The '%s' repository could not be scanned: %s\n", result.Repository, result.Error)
+	}
+
+	violating := report.Violating()
+	for _, result := range violating {
+		for _, violation := range result.Violations {
+			switch violation {
+			case fresh_container.ViolationNoSemverTag:
+				fmt.Printf("The '%s' repository has no tag following semantic versioning\n", result.Repository)
+			case fresh_container.ViolationMaxAge:
+				fmt.Printf(
+					"The newest tag of the '%s' repository, '%s', was built on %s, longer than %s ago\n",
+					result.Repository,
+					result.LatestTag,
+					result.LatestCreated.Format(time.RFC3339),
+					report.MaxAge)
+			}
+		}
+	}
+
+	if len(violating) == 0 && len(failed) == 0 {
+		fmt.Printf(
+			"None of the %d repositories of the %s registry breaks the policy\n",
+			len(report.Repositories),
+			report.Registry)
+		return nil
+	}
+
+	if len(violating) == 0 {
+		return cli.NewExitError(scanFailedError(report, failed), 1)
+	}
+
+	err := fmt.Errorf(
+		"%d of the %d repositories of the %s registry break the policy.",
+		len(violating),
+		len(report.Repositories),
+		report.Registry)
+	if len(failed) > 0 {
+		err = fmt.Errorf("%v %d could not be scanned.", err, len(failed))
+	}
+	return cli.NewExitError(err, 1)
+}
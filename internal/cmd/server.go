@@ -20,7 +20,7 @@ func RunServer(c *cli.Context) error {
 	var err error
 
 	// ensure cleanup is done when the program is terminated
-	sigChannel := make(chan os.Signal)
+	sigChannel := make(chan os.Signal, 1)
 	signal.Notify(sigChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGKILL)
 	go func() {
 		<-sigChannel
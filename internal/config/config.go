@@ -2,10 +2,33 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/registries"
+)
+
+const (
+	DEFAULT_CACHE_TTL_HOURS = 2
+	DEFAULT_TAGS_PAGE_SIZE  = 100
+	DEFAULT_TAGS_MAX_PAGES  = 100
+
+	DEFAULT_REGISTRY_TIMEOUT          = "30s"
+	DEFAULT_REGISTRY_MAX_RETRIES      = 3
+	DEFAULT_REGISTRY_BACKOFF          = "500ms"
+	DEFAULT_REGISTRY_MAX_BACKOFF      = "10s"
+	DEFAULT_CIRCUIT_BREAKER_THRESHOLD = 5
+	DEFAULT_CIRCUIT_BREAKER_COOLDOWN  = "1m"
 )
 
-const DEFAULT_CACHE_TTL_HOURS = 2
+var (
+	// Directories following the `<dir>/<host>/` layout used by docker
+	// and podman to store the certificates of each registry
+	DEFAULT_CERTS_DIRS = []string{"/etc/containers/certs.d", "/etc/docker/certs.d"}
+)
 
 type RegistryConfig struct {
 	AuthDomain string `json:"auth_domain"`
@@ -14,25 +37,251 @@ type RegistryConfig struct {
 	SkipPing   bool   `json:"skip_ping"`
 	Username   string `json:"username"`
 	Password   string `json:"password"`
+	// Pre-issued bearer token sent as it is to the registry
+	RegistryToken string `json:"registry_token"`
+	// Refresh token exchanged at the realm of the authentication challenge
+	IdentityToken string `json:"identity_token"`
+	// The secrets can also be read from a file or from an environment
+	// variable, instead of being stored inside of the configuration file
+	PasswordFile      string `json:"password_file"`
+	PasswordEnv       string `json:"password_env"`
+	RegistryTokenFile string `json:"registry_token_file"`
+	RegistryTokenEnv  string `json:"registry_token_env"`
+	IdentityTokenFile string `json:"identity_token_file"`
+	IdentityTokenEnv  string `json:"identity_token_env"`
+	// Number of tags, or repositories, requested for each page of the
+	// tag list, or of the catalog
+	TagsPageSize int `json:"tags_page_size"`
+	// Maximum number of tag list, or catalog, pages fetched, a negative
+	// value means no limit
+	TagsMaxPages int `json:"tags_max_pages"`
+	// Tags built more recently than this are not recommended, e.g. `72h`
+	MinReleaseAge string `json:"min_release_age"`
+	// Timeout of each attempt of a request, e.g. `30s`, `0s` disables it
+	Timeout string `json:"timeout"`
+	// Number of times failed idempotent requests are retried, zero
+	// means the default value and a negative one disables the retries
+	MaxRetries int `json:"max_retries"`
+	// Delay before the first retry, it doubles at each attempt
+	Backoff string `json:"backoff"`
+	// Upper bound of the delay between two attempts
+	MaxBackoff string `json:"max_backoff"`
+	// Number of consecutive failures after which the registry is not
+	// contacted anymore for a while, zero means the default value and
+	// a negative one disables the circuit breaker
+	CircuitBreakerThreshold int `json:"circuit_breaker_threshold"`
+	// How long the registry is not contacted once the circuit breaker trips
+	CircuitBreakerCooldown string `json:"circuit_breaker_cooldown"`
+	// PEM bundle of the certificate authorities trusted for this registry,
+	// in addition to the system ones
+	CAFile string `json:"ca_file"`
+	// PEM client certificate and key used for mutual TLS authentication
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// RepositoryConfig holds the options that can be set for a single
+// repository, they take precedence over the ones of its registry
+type RepositoryConfig struct {
+	// Tags built more recently than this are not recommended, e.g. `72h`
+	MinReleaseAge string `json:"min_release_age"`
+	// Version scheme followed by the tags, e.g. `calver`
+	Scheme string `json:"scheme"`
+	// Tags that must never be recommended: versions, glob patterns
+	// or regular expressions enclosed by slashes
+	Exclude []string `json:"exclude"`
 }
 
 type Config struct {
 	Registries    map[string]RegistryConfig `json:"registries"`
 	CacheTTLHours int                       `json:"cache_ttl_hours"`
+	// Repository specific options, the full name of the repository
+	// (e.g. `docker.io/library/nginx`) is used as key
+	Repositories map[string]RepositoryConfig `json:"repositories"`
+	// Ordered list of the places where registry credentials are looked up
+	CredentialSources []string `json:"credential_sources"`
+	// Kubernetes pull secrets, either the files holding the
+	// `.dockerconfigjson` key or the directories where they are mounted
+	KubernetesPullSecrets []string `json:"kubernetes_pull_secrets"`
+	// Path to a containers-registries.conf(5) file
+	RegistriesConfPath string `json:"registries_conf"`
+	// Directories holding the certificates of the registries using the
+	// `<dir>/<host>/` layout, an empty list disables the lookup
+	CertsDirs []string `json:"certs_dirs"`
+	// Coerce tags like `v1.2.3`, `1.21` or `3` into versions, instead
+	// of ignoring them
+	LooseVersions bool `json:"loose_versions"`
+
+	registriesConf *registries.Conf
 }
 
 func (c *Config) GetRegistryConfig(domain string) RegistryConfig {
 	rc, found := c.Registries[domain]
-	if found {
-		return rc
+	if !found {
+		rc = RegistryConfig{
+			AuthDomain: domain,
+			Insecure:   false,
+			NonSSL:     false,
+			SkipPing:   false,
+		}
 	}
+	rc.fixDefaults()
 
-	return RegistryConfig{
-		AuthDomain: domain,
-		Insecure:   false,
-		NonSSL:     false,
-		SkipPing:   false,
+	return rc
+}
+
+// GetMinReleaseAge returns the minimum release age of the tags of the
+// repository, an empty string when none has been set
+func (c *Config) GetMinReleaseAge(domain, repository string) string {
+	if repo, found := c.Repositories[domain+"/"+repository]; found && repo.MinReleaseAge != "" {
+		return repo.MinReleaseAge
 	}
+
+	return c.GetRegistryConfig(domain).MinReleaseAge
+}
+
+// GetScheme returns the version scheme followed by the tags of the
+// repository, an empty string when none has been set
+func (c *Config) GetScheme(domain, repository string) string {
+	return c.Repositories[domain+"/"+repository].Scheme
+}
+
+// GetExclude returns the tags of the repository that must never be
+// recommended
+func (c *Config) GetExclude(domain, repository string) []string {
+	return c.Repositories[domain+"/"+repository].Exclude
+}
+
+// fixDefaults sets the options that have not been specified, the
+// negative values disabling a feature are kept
+func (rc *RegistryConfig) fixDefaults() {
+	if rc.TagsPageSize == 0 {
+		rc.TagsPageSize = DEFAULT_TAGS_PAGE_SIZE
+	}
+	if rc.TagsMaxPages == 0 {
+		rc.TagsMaxPages = DEFAULT_TAGS_MAX_PAGES
+	}
+	if rc.Timeout == "" {
+		rc.Timeout = DEFAULT_REGISTRY_TIMEOUT
+	}
+	if rc.MaxRetries == 0 {
+		rc.MaxRetries = DEFAULT_REGISTRY_MAX_RETRIES
+	}
+	if rc.Backoff == "" {
+		rc.Backoff = DEFAULT_REGISTRY_BACKOFF
+	}
+	if rc.MaxBackoff == "" {
+		rc.MaxBackoff = DEFAULT_REGISTRY_MAX_BACKOFF
+	}
+	if rc.CircuitBreakerThreshold == 0 {
+		rc.CircuitBreakerThreshold = DEFAULT_CIRCUIT_BREAKER_THRESHOLD
+	}
+	if rc.CircuitBreakerCooldown == "" {
+		rc.CircuitBreakerCooldown = DEFAULT_CIRCUIT_BREAKER_COOLDOWN
+	}
+}
+
+// TimeoutDuration returns the timeout of each attempt of a request,
+// zero when the timeout is disabled
+func (rc *RegistryConfig) TimeoutDuration() time.Duration {
+	return parseDuration(rc.Timeout, DEFAULT_REGISTRY_TIMEOUT)
+}
+
+// BackoffDuration returns the delay before the first retry
+func (rc *RegistryConfig) BackoffDuration() time.Duration {
+	return parseDuration(rc.Backoff, DEFAULT_REGISTRY_BACKOFF)
+}
+
+// MaxBackoffDuration returns the upper bound of the delay between two attempts
+func (rc *RegistryConfig) MaxBackoffDuration() time.Duration {
+	return parseDuration(rc.MaxBackoff, DEFAULT_REGISTRY_MAX_BACKOFF)
+}
+
+// CircuitBreakerCooldownDuration returns how long the registry is not
+// contacted once the circuit breaker trips
+func (rc *RegistryConfig) CircuitBreakerCooldownDuration() time.Duration {
+	return parseDuration(rc.CircuitBreakerCooldown, DEFAULT_CIRCUIT_BREAKER_COOLDOWN)
+}
+
+func (rc *RegistryConfig) validate() error {
+	for key, value := range map[string]string{
+		"timeout":                  rc.Timeout,
+		"backoff":                  rc.Backoff,
+		"max_backoff":              rc.MaxBackoff,
+		"circuit_breaker_cooldown": rc.CircuitBreakerCooldown,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("Invalid %s value: %s", key, value)
+		}
+	}
+	if (rc.CertFile == "") != (rc.KeyFile == "") {
+		return fmt.Errorf("Both cert_file and key_file must be specified")
+	}
+	for key, values := range map[string][]string{
+		"password":       []string{rc.Password, rc.PasswordFile, rc.PasswordEnv},
+		"registry_token": []string{rc.RegistryToken, rc.RegistryTokenFile, rc.RegistryTokenEnv},
+		"identity_token": []string{rc.IdentityToken, rc.IdentityTokenFile, rc.IdentityTokenEnv},
+	} {
+		set := 0
+		for _, value := range values {
+			if value != "" {
+				set++
+			}
+		}
+		if set > 1 {
+			return fmt.Errorf("Only one of %s, %s_file and %s_env can be specified", key, key, key)
+		}
+	}
+	return nil
+}
+
+// ReadSecrets loads the secrets stored inside of files or environment
+// variables. The files are read each time, so rotated secrets are
+// picked up without restarting the server.
+func (rc *RegistryConfig) ReadSecrets() error {
+	var err error
+	if rc.Password, err = readSecret(rc.Password, rc.PasswordFile, rc.PasswordEnv); err != nil {
+		return err
+	}
+	if rc.RegistryToken, err = readSecret(rc.RegistryToken, rc.RegistryTokenFile, rc.RegistryTokenEnv); err != nil {
+		return err
+	}
+	rc.IdentityToken, err = readSecret(rc.IdentityToken, rc.IdentityTokenFile, rc.IdentityTokenEnv)
+	return err
+}
+
+func readSecret(value, file, env string) (string, error) {
+	switch {
+	case value != "":
+		return value, nil
+	case file != "":
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("Cannot read secret file: %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case env != "":
+		secret, found := os.LookupEnv(env)
+		if !found {
+			return "", fmt.Errorf("Environment variable %s is not set", env)
+		}
+		return secret, nil
+	default:
+		return "", nil
+	}
+}
+
+// parseDuration parses a duration that has already been validated,
+// falling back to the default value
+func parseDuration(value, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		d, _ = time.ParseDuration(defaultValue)
+	}
+	return d
 }
 
 func NewConfig() Config {
@@ -55,11 +304,36 @@ func NewFromFile(path string) (cfg Config, err error) {
 	}
 	cfg.fixDefaults()
 
+	for domain, rc := range cfg.Registries {
+		if err = rc.validate(); err != nil {
+			err = fmt.Errorf("Registry %s: %v", domain, err)
+			return
+		}
+	}
+
+	if cfg.RegistriesConfPath != "" {
+		cfg.registriesConf, err = registries.Load(cfg.RegistriesConfPath)
+	}
+
 	return
 }
 
+// RegistriesConf returns the contents of the registries.conf file
+// referenced by the configuration. An empty registries.conf, which
+// resolves short names against Docker Hub, is returned when none
+// has been specified.
+func (c *Config) RegistriesConf() *registries.Conf {
+	if c.registriesConf == nil {
+		return &registries.Conf{}
+	}
+	return c.registriesConf
+}
+
 func (c *Config) fixDefaults() {
 	if c.CacheTTLHours == 0 {
 		c.CacheTTLHours = DEFAULT_CACHE_TTL_HOURS
 	}
+	if c.CertsDirs == nil {
+		c.CertsDirs = DEFAULT_CERTS_DIRS
+	}
 }
@@ -0,0 +1,319 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flavio/fresh-container/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Credentials stored inside of the fresh-container configuration file
+	SourceConfig = "config"
+	// Docker configuration file: $DOCKER_CONFIG/config.json or ~/.docker/config.json
+	SourceDocker = "docker"
+	// Podman authentication file: $REGISTRY_AUTH_FILE or $XDG_RUNTIME_DIR/containers/auth.json
+	SourcePodman = "podman"
+	// Kubernetes `dockerconfigjson` pull secrets mounted inside of the container
+	SourceKubernetes = "kubernetes"
+
+	dockerHubServerURL = "https://index.docker.io/v1/"
+)
+
+var (
+	DefaultSources = []string{SourceConfig, SourceDocker, SourcePodman, SourceKubernetes}
+)
+
+// Credentials holds the secrets used to authenticate against a registry
+type Credentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+	RegistryToken string
+}
+
+// IsEmpty returns true when no secret has been found
+func (c Credentials) IsEmpty() bool {
+	return c.Username == "" && c.Password == "" && c.IdentityToken == "" && c.RegistryToken == ""
+}
+
+// authFile is the format shared by the docker configuration file,
+// the containers auth.json file and the `.dockerconfigjson` key of
+// Kubernetes pull secrets
+type authFile struct {
+	Auths       map[string]authEntry `json:"auths"`
+	CredHelpers map[string]string    `json:"credHelpers"`
+	CredsStore  string               `json:"credsStore"`
+}
+
+type authEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// Lookup searches the credentials of the given registry going through
+// the sources listed inside of the configuration, in order. The first
+// source providing credentials wins.
+// Empty credentials are returned when no source knows about the registry.
+func Lookup(ctx context.Context, cfg *config.Config, domain, repository string) (Credentials, error) {
+	sources := cfg.CredentialSources
+	if len(sources) == 0 {
+		sources = DefaultSources
+	}
+
+	for _, source := range sources {
+		creds, origin, err := lookupSource(ctx, cfg, source, domain, repository)
+		if err != nil {
+			return Credentials{}, err
+		}
+
+		if !creds.IsEmpty() {
+			log.WithFields(log.Fields{
+				"registry": domain,
+				"source":   source,
+				"origin":   origin,
+			}).Debug("Registry credentials found")
+			return creds, nil
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"registry": domain,
+		"sources":  sources,
+	}).Debug("No registry credentials found, using anonymous access")
+
+	return Credentials{}, nil
+}
+
+func lookupSource(ctx context.Context, cfg *config.Config, source, domain, repository string) (Credentials, string, error) {
+	switch source {
+	case SourceConfig:
+		rc := cfg.GetRegistryConfig(domain)
+		if err := rc.ReadSecrets(); err != nil {
+			return Credentials{}, "", fmt.Errorf("Registry %s: %v", domain, err)
+		}
+		return Credentials{
+			Username:      rc.Username,
+			Password:      rc.Password,
+			IdentityToken: rc.IdentityToken,
+			RegistryToken: rc.RegistryToken,
+		}, "configuration file", nil
+	case SourceDocker:
+		return lookupFiles(ctx, dockerConfigFiles(), domain, repository)
+	case SourcePodman:
+		return lookupFiles(ctx, podmanAuthFiles(), domain, repository)
+	case SourceKubernetes:
+		return lookupFiles(ctx, kubernetesPullSecretFiles(cfg.KubernetesPullSecrets), domain, repository)
+	default:
+		return Credentials{}, "", fmt.Errorf(
+			"Unknown credential source %s. Valid ones are %+v",
+			source,
+			DefaultSources)
+	}
+}
+
+func dockerConfigFiles() []string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return []string{}
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	return []string{filepath.Join(dir, "config.json")}
+}
+
+func podmanAuthFiles() []string {
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		return []string{path}
+	}
+
+	files := []string{}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "containers", "auth.json"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".config", "containers", "auth.json"))
+	}
+
+	return files
+}
+
+// kubernetesPullSecretFiles expands the given paths into the list of the
+// pull secret files. A path can either be a file or the directory where
+// a secret, or a set of secrets, has been mounted.
+func kubernetesPullSecretFiles(paths []string) []string {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		dirs := []string{path}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			// skip the `..data` links created by the kubelet
+			if strings.HasPrefix(entry.Name(), "..") {
+				continue
+			}
+			dirs = append(dirs, filepath.Join(path, entry.Name()))
+		}
+
+		for _, dir := range dirs {
+			for _, name := range []string{".dockerconfigjson", ".dockercfg"} {
+				file := filepath.Join(dir, name)
+				if info, err := os.Stat(file); err == nil && !info.IsDir() {
+					files = append(files, file)
+				}
+			}
+		}
+	}
+
+	return files
+}
+
+func lookupFiles(ctx context.Context, files []string, domain, repository string) (Credentials, string, error) {
+	for _, file := range files {
+		af, err := readAuthFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return Credentials{}, "", err
+		}
+
+		creds, origin, err := af.lookup(ctx, domain, repository)
+		if err != nil {
+			return Credentials{}, "", fmt.Errorf("%s: %v", file, err)
+		}
+		if !creds.IsEmpty() {
+			return creds, fmt.Sprintf("%s (%s)", file, origin), nil
+		}
+	}
+
+	return Credentials{}, "", nil
+}
+
+func readAuthFile(path string) (authFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return authFile{}, err
+	}
+
+	var af authFile
+	if err = json.Unmarshal(data, &af); err != nil {
+		return authFile{}, fmt.Errorf("Cannot parse %s: %v", path, err)
+	}
+
+	if af.Auths == nil && af.CredHelpers == nil && af.CredsStore == "" {
+		// legacy `.dockercfg` format: the auths are stored at the top level
+		if err = json.Unmarshal(data, &af.Auths); err != nil {
+			return authFile{}, fmt.Errorf("Cannot parse %s: %v", path, err)
+		}
+	}
+
+	return af, nil
+}
+
+// lookup finds the credentials of the registry. As done by the docker cli,
+// credential helpers take precedence over the credential store, which takes
+// precedence over the credentials stored inside of the file.
+func (af *authFile) lookup(ctx context.Context, domain, repository string) (Credentials, string, error) {
+	for key, helper := range af.CredHelpers {
+		if normalizeKey(key) == domain {
+			creds, err := runCredentialHelper(ctx, helper, domain)
+			return creds, "credential helper " + helper, err
+		}
+	}
+
+	if af.CredsStore != "" {
+		creds, err := runCredentialHelper(ctx, af.CredsStore, domain)
+		if err != nil || !creds.IsEmpty() {
+			return creds, "credential store " + af.CredsStore, err
+		}
+	}
+
+	// The most specific entry wins: `registry/namespace/repo` entries,
+	// used by podman, take precedence over `registry` ones
+	bestKey := ""
+	var best authEntry
+	for key, entry := range af.Auths {
+		normalized := normalizeKey(key)
+		if normalized != domain && !strings.HasPrefix(domain+"/"+repository+"/", normalized+"/") {
+			continue
+		}
+		if len(normalized) > len(bestKey) {
+			bestKey = normalized
+			best = entry
+		}
+	}
+	if bestKey == "" {
+		return Credentials{}, "", nil
+	}
+
+	creds, err := best.credentials()
+	return creds, "auths " + bestKey, err
+}
+
+func (e authEntry) credentials() (Credentials, error) {
+	creds := Credentials{
+		Username:      e.Username,
+		Password:      e.Password,
+		IdentityToken: e.IdentityToken,
+		RegistryToken: e.RegistryToken,
+	}
+
+	if e.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("Cannot decode the auth field: %v", err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return Credentials{}, fmt.Errorf("Invalid auth field: must be a base64 encoded `username:password` string")
+		}
+		creds.Username = parts[0]
+		creds.Password = parts[1]
+	}
+
+	return creds, nil
+}
+
+// normalizeKey turns the keys used inside of the auth files, which can
+// be URLs, into `registry[/namespace]` strings
+func normalizeKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key = strings.TrimSuffix(key, "/")
+	key = strings.TrimSuffix(key, "/v1")
+	key = strings.TrimSuffix(key, "/v2")
+
+	parts := strings.SplitN(key, "/", 2)
+	switch parts[0] {
+	case "index.docker.io", "registry-1.docker.io":
+		parts[0] = "docker.io"
+	}
+
+	return strings.Join(parts, "/")
+}
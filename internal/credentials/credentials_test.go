@@ -0,0 +1,217 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+func writeFile(t *testing.T, path, content string, perm os.FileMode) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+type LookupTestCase struct {
+	Sources          []string
+	Domain           string
+	Repository       string
+	ExpectedUsername string
+	ExpectedPassword string
+}
+
+func TestLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fresh-container-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "docker", "config.json"), `{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "`+basicAuth("docker-hub", "secret")+`"},
+    "registry.local.lan": {"auth": "`+basicAuth("docker-local", "secret")+`"}
+  },
+  "credHelpers": {
+    "helper.local.lan": "fake",
+    "missing.local.lan": "not-installed"
+  }
+}`, 0600)
+	writeFile(t, filepath.Join(dir, "run", "containers", "auth.json"), `{
+  "auths": {
+    "registry.local.lan": {"auth": "`+basicAuth("podman-local", "secret")+`"},
+    "registry.local.lan/team": {"auth": "`+basicAuth("podman-team", "secret")+`"}
+  }
+}`, 0600)
+	writeFile(t, filepath.Join(dir, "secrets", "pull-secret", ".dockerconfigjson"), `{
+  "auths": {
+    "registry.local.lan": {"username": "kubernetes-local", "password": "secret"}
+  }
+}`, 0600)
+	writeFile(t, filepath.Join(dir, "bin", "docker-credential-fake"), `#!/bin/sh
+read server
+echo "{\"ServerURL\": \"$server\", \"Username\": \"helper-$server\", \"Secret\": \"secret\"}"
+`, 0755)
+
+	writeFile(t, filepath.Join(dir, "password"), "file secret\n", 0600)
+
+	os.Setenv("FRESH_CONTAINER_TEST_PASSWORD", "env secret")
+	os.Setenv("DOCKER_CONFIG", filepath.Join(dir, "docker"))
+	os.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+	os.Unsetenv("REGISTRY_AUTH_FILE")
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	testCases := []LookupTestCase{
+		LookupTestCase{
+			Domain:           "docker.io",
+			Repository:       "library/nginx",
+			ExpectedUsername: "docker-hub",
+			ExpectedPassword: "secret",
+		},
+		LookupTestCase{
+			Domain:           "registry.local.lan",
+			Repository:       "team/app",
+			ExpectedUsername: "inline",
+			ExpectedPassword: "inline secret",
+		},
+		LookupTestCase{
+			Sources:          []string{SourcePodman, SourceDocker},
+			Domain:           "registry.local.lan",
+			Repository:       "team/app",
+			ExpectedUsername: "podman-team",
+			ExpectedPassword: "secret",
+		},
+		LookupTestCase{
+			Sources:          []string{SourcePodman, SourceDocker},
+			Domain:           "registry.local.lan",
+			Repository:       "other/app",
+			ExpectedUsername: "podman-local",
+			ExpectedPassword: "secret",
+		},
+		LookupTestCase{
+			Sources:          []string{SourceKubernetes, SourceDocker},
+			Domain:           "registry.local.lan",
+			Repository:       "team/app",
+			ExpectedUsername: "kubernetes-local",
+			ExpectedPassword: "secret",
+		},
+		LookupTestCase{
+			Domain:           "helper.local.lan",
+			Repository:       "app",
+			ExpectedUsername: "helper-helper.local.lan",
+			ExpectedPassword: "secret",
+		},
+		LookupTestCase{
+			Domain:           "file.local.lan",
+			Repository:       "app",
+			ExpectedUsername: "file",
+			ExpectedPassword: "file secret",
+		},
+		LookupTestCase{
+			Domain:           "env.local.lan",
+			Repository:       "app",
+			ExpectedUsername: "env",
+			ExpectedPassword: "env secret",
+		},
+		LookupTestCase{
+			// the helper is not installed, anonymous access is used
+			Domain:     "missing.local.lan",
+			Repository: "app",
+		},
+		LookupTestCase{
+			Domain:     "unknown.local.lan",
+			Repository: "app",
+		},
+	}
+
+	for _, tc := range testCases {
+		cfg := config.NewConfig()
+		cfg.CredentialSources = tc.Sources
+		cfg.KubernetesPullSecrets = []string{filepath.Join(dir, "secrets")}
+		cfg.Registries = map[string]config.RegistryConfig{
+			"registry.local.lan": config.RegistryConfig{
+				Username: "inline",
+				Password: "inline secret",
+			},
+			"file.local.lan": config.RegistryConfig{
+				Username:     "file",
+				PasswordFile: filepath.Join(dir, "password"),
+			},
+			"env.local.lan": config.RegistryConfig{
+				Username:    "env",
+				PasswordEnv: "FRESH_CONTAINER_TEST_PASSWORD",
+			},
+		}
+
+		creds, err := Lookup(context.Background(), &cfg, tc.Domain, tc.Repository)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		if creds.Username != tc.ExpectedUsername || creds.Password != tc.ExpectedPassword {
+			t.Errorf("Unexpected credentials for test case %+v, got %s:%s",
+				tc,
+				creds.Username,
+				creds.Password)
+		}
+	}
+}
+
+func TestLookupUnknownSource(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CredentialSources = []string{"vault"}
+
+	_, err := Lookup(context.Background(), &cfg, "docker.io", "library/nginx")
+	if err == nil {
+		t.Error("Expected failure using an unknown credential source")
+	}
+}
+
+func TestLookupMissingCredentialStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fresh-container-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "config.json"), `{
+  "auths": {
+    "registry.local.lan": {"auth": "`+basicAuth("docker-local", "secret")+`"}
+  },
+  "credsStore": "not-installed"
+}`, 0600)
+	os.Setenv("DOCKER_CONFIG", dir)
+
+	cfg := config.NewConfig()
+	cfg.CredentialSources = []string{SourceDocker}
+
+	// the credentials stored inside of the file are used instead
+	creds, err := Lookup(context.Background(), &cfg, "registry.local.lan", "app")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.Username != "docker-local" || creds.Password != "secret" {
+		t.Errorf("Unexpected credentials %s:%s", creds.Username, creds.Password)
+	}
+
+	creds, err = Lookup(context.Background(), &cfg, "docker.io", "library/nginx")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !creds.IsEmpty() {
+		t.Errorf("Expected anonymous access, got %+v", creds)
+	}
+}
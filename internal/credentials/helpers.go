@@ -0,0 +1,75 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Username returned by credential helpers when the secret is an identity token
+const identityTokenUsername = "<token>"
+
+type helperResponse struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// runCredentialHelper invokes the `docker-credential-<helper>` executable
+// to retrieve the credentials of the registry, following the protocol
+// defined by https://github.com/docker/docker-credential-helpers
+// Empty credentials are returned when the helper is not installed.
+func runCredentialHelper(ctx context.Context, helper, domain string) (Credentials, error) {
+	program := "docker-credential-" + helper
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, "get")
+	cmd.Stdin = strings.NewReader(helperServerURL(domain))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+			// Like the docker cli, don't prevent anonymous access
+			// to the registry because of a missing helper
+			log.WithFields(log.Fields{
+				"registry": domain,
+				"helper":   program,
+			}).Warn("Credential helper not installed, ignoring it")
+			return Credentials{}, nil
+		}
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(output, "credentials not found") {
+			return Credentials{}, nil
+		}
+		return Credentials{}, fmt.Errorf("%s failed: %v %s", program, err, output)
+	}
+
+	var resp helperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return Credentials{}, fmt.Errorf("Cannot parse the output of %s: %v", program, err)
+	}
+
+	if resp.Username == identityTokenUsername {
+		return Credentials{IdentityToken: resp.Secret}, nil
+	}
+
+	return Credentials{
+		Username: resp.Username,
+		Password: resp.Secret,
+	}, nil
+}
+
+// helperServerURL returns the server URL used by the docker cli when
+// storing the credentials of the registry
+func helperServerURL(domain string) string {
+	if domain == "docker.io" {
+		return dockerHubServerURL
+	}
+	return domain
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flavio/fresh-container/pkg/fresh_container"
+
+	badger "github.com/dgraph-io/badger/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+func (d *DB) GetImageDigest(image fresh_container.Image) (string, error) {
+	key := fmt.Sprintf("digests/%s", image.FullNameWithTag())
+	var digest string
+
+	err := d.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			digest = string(val)
+			return nil
+		})
+	})
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"image": image.FullNameWithTag(),
+			"error": err,
+		}).Error("db.GetImageDigest")
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"image":  image.FullNameWithTag(),
+		"digest": digest,
+	}).Debug("db.GetImageDigest")
+	return digest, nil
+}
+
+func (d *DB) SetImageDigest(image fresh_container.Image, digest string) error {
+	key := fmt.Sprintf("digests/%s", image.FullNameWithTag())
+
+	return d.db.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry([]byte(key), []byte(digest)).
+			WithTTL(time.Duration(d.config.CacheTTLHours) * time.Hour)
+		return txn.SetEntry(entry)
+	})
+}
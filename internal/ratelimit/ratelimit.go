@@ -0,0 +1,303 @@
+// Package ratelimit keeps track of the request budget of the registries,
+// using the rate limit headers they return. Docker Hub, for example,
+// limits the number of manifests anonymous users can pull.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Window assumed when the registry does not advertise it
+	defaultWindow = time.Hour
+	// Delay used when the registry rejects a request without
+	// telling when it can be retried
+	defaultRetryAfter = time.Minute
+)
+
+// Default holds the budgets shared by all the registry clients
+// of the process
+var Default = New()
+
+// Limits holds a token bucket for each registry. The buckets are created
+// once a registry advertises its limit, until then requests are never
+// throttled.
+type Limits struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	limit        int
+	window       time.Duration
+	tokens       float64
+	updated      time.Time
+	blockedUntil time.Time
+}
+
+// Status describes the budget left for a registry
+type Status struct {
+	Registry      string     `json:"registry"`
+	Limit         int        `json:"limit"`
+	Remaining     int        `json:"remaining"`
+	WindowSeconds int        `json:"window_seconds"`
+	BlockedUntil  *time.Time `json:"blocked_until,omitempty"`
+}
+
+// Error is returned when the budget of a registry is exhausted
+type Error struct {
+	Registry   string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(
+		"The rate limit of the %s registry has been reached, retry in %s",
+		e.Registry,
+		e.RetryAfter.Round(time.Second))
+}
+
+// Delay returns how long to wait before retrying, background jobs
+// failing with this error are delayed by that amount of time
+func (e *Error) Delay() time.Duration {
+	return e.RetryAfter
+}
+
+func New() *Limits {
+	return &Limits{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take consumes a token from the bucket of the registry. An `*Error`
+// is returned when the budget is exhausted.
+func (l *Limits) Take(registry string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, found := l.buckets[registry]
+	if !found {
+		return nil
+	}
+
+	now := l.now()
+	b.refill(now)
+
+	if now.Before(b.blockedUntil) {
+		return &Error{Registry: registry, RetryAfter: b.blockedUntil.Sub(now)}
+	}
+	if b.limit == 0 {
+		// The registry did not advertise its limit, only the delay
+		// it asked for is honored: the bucket cannot be refilled
+		return nil
+	}
+	if b.tokens < 1 {
+		return &Error{Registry: registry, RetryAfter: b.timeToToken()}
+	}
+
+	b.tokens--
+	return nil
+}
+
+// Observe updates the bucket of the registry using the `RateLimit-Limit`,
+// `RateLimit-Remaining` and `Retry-After` headers of the response.
+// An `*Error` is returned when the registry rejected the request
+// because of its rate limit.
+func (l *Limits) Observe(registry string, statusCode int, header http.Header) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	limit, window, hasLimit := parseQuota(header.Get("RateLimit-Limit"))
+	remaining, _, hasRemaining := parseQuota(header.Get("RateLimit-Remaining"))
+	retryAfter, hasRetryAfter := parseRetryAfter(header.Get("Retry-After"), now)
+
+	b, found := l.buckets[registry]
+	if !found {
+		if !hasLimit && !hasRetryAfter && statusCode != http.StatusTooManyRequests {
+			return nil
+		}
+		b = &bucket{window: defaultWindow, updated: now, tokens: float64(limit)}
+		l.buckets[registry] = b
+	}
+	b.refill(now)
+
+	if hasLimit {
+		b.limit = limit
+		if window > 0 {
+			b.window = window
+		}
+	}
+	if hasRemaining {
+		b.tokens = float64(remaining)
+	}
+	if hasRetryAfter {
+		b.blockedUntil = now.Add(retryAfter)
+	}
+
+	if statusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	b.tokens = 0
+	if !hasRetryAfter {
+		if b.limit > 0 {
+			retryAfter = b.timeToToken()
+		} else {
+			retryAfter = defaultRetryAfter
+		}
+		b.blockedUntil = now.Add(retryAfter)
+	}
+
+	log.WithFields(log.Fields{
+		"registry":    registry,
+		"retry_after": retryAfter.String(),
+	}).Warn("Registry rate limit reached")
+
+	return &Error{Registry: registry, RetryAfter: retryAfter}
+}
+
+// Status returns the budget of all the registries that advertised
+// their rate limit, sorted by registry
+func (l *Limits) Status() []Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	statuses := []Status{}
+	for registry, b := range l.buckets {
+		b.refill(now)
+		s := Status{
+			Registry:      registry,
+			Limit:         b.limit,
+			Remaining:     int(math.Floor(b.tokens)),
+			WindowSeconds: int(b.window.Seconds()),
+		}
+		if now.Before(b.blockedUntil) {
+			blockedUntil := b.blockedUntil
+			s.BlockedUntil = &blockedUntil
+		}
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Registry < statuses[j].Registry
+	})
+	return statuses
+}
+
+// refill adds the tokens earned since the last update, the bucket
+// is refilled at a constant pace over the window of the registry
+func (b *bucket) refill(now time.Time) {
+	if b.limit > 0 && b.window > 0 && now.After(b.updated) {
+		b.tokens += now.Sub(b.updated).Seconds() * float64(b.limit) / b.window.Seconds()
+		b.tokens = math.Min(b.tokens, float64(b.limit))
+	}
+	b.updated = now
+}
+
+// timeToToken returns how long it takes to earn the next token
+func (b *bucket) timeToToken() time.Duration {
+	if b.limit <= 0 || b.window <= 0 {
+		return defaultRetryAfter
+	}
+
+	missing := 1 - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing * b.window.Seconds() / float64(b.limit) * float64(time.Second))
+}
+
+// parseQuota parses values like `100;w=21600`, the window being
+// optional and expressed in seconds
+func parseQuota(value string) (int, time.Duration, bool) {
+	if value == "" {
+		return 0, 0, false
+	}
+
+	parts := strings.Split(value, ";")
+	quota, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || quota < 0 {
+		return 0, 0, false
+	}
+
+	var window time.Duration
+	for _, param := range parts[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "w=") {
+			if seconds, err := strconv.Atoi(param[2:]); err == nil && seconds > 0 {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return quota, window, true
+}
+
+// parseRetryAfter parses the `Retry-After` header, which holds either
+// a number of seconds or a date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if date.Before(now) {
+			return 0, true
+		}
+		return date.Sub(now), true
+	}
+
+	return 0, false
+}
+
+// Transport wraps the given round tripper: requests are rejected with
+// an `*Error` once the budget of the registry is exhausted, the
+// headers of all the responses are used to update the budget
+func (l *Limits) Transport(registry string, next http.RoundTripper) http.RoundTripper {
+	return &transport{
+		limits:   l,
+		registry: registry,
+		next:     next,
+	}
+}
+
+type transport struct {
+	limits   *Limits
+	registry string
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limits.Take(t.registry); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if err = t.limits.Observe(t.registry, resp.StatusCode, resp.Header); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
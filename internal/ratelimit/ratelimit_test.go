@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimits() (*Limits, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New()
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestUnknownRegistryIsNotThrottled(t *testing.T) {
+	l, _ := newTestLimits()
+
+	for i := 0; i < 10; i++ {
+		if err := l.Take("registry.local.lan"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := l.Observe("registry.local.lan", http.StatusOK, http.Header{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(l.Status()) != 0 {
+		t.Errorf("Registries without rate limit headers should not be tracked")
+	}
+}
+
+func TestBudgetExhaustion(t *testing.T) {
+	l, clock := newTestLimits()
+
+	header := http.Header{}
+	header.Set("RateLimit-Limit", "100;w=21600")
+	header.Set("RateLimit-Remaining", "2;w=21600")
+	if err := l.Observe("docker.io", http.StatusOK, header); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := l.Take("docker.io"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	err := l.Take("docker.io")
+	var limited *Error
+	if !errors.As(err, &limited) {
+		t.Fatalf("Expected a rate limit error, got %v", err)
+	}
+	// 100 pulls every 6 hours: one token every 216 seconds
+	if limited.Delay() != 216*time.Second {
+		t.Errorf("Unexpected delay %s", limited.Delay())
+	}
+
+	clock.now = clock.now.Add(216 * time.Second)
+	if err := l.Take("docker.io"); err != nil {
+		t.Errorf("The bucket should have been refilled: %v", err)
+	}
+
+	status := l.Status()
+	if len(status) != 1 || status[0].Limit != 100 || status[0].Remaining != 0 || status[0].WindowSeconds != 21600 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	l, clock := newTestLimits()
+
+	header := http.Header{}
+	header.Set("Retry-After", "120")
+	err := l.Observe("docker.io", http.StatusTooManyRequests, header)
+	var limited *Error
+	if !errors.As(err, &limited) || limited.Delay() != 120*time.Second {
+		t.Fatalf("Expected a rate limit error with a 120 seconds delay, got %v", err)
+	}
+
+	if err = l.Take("docker.io"); !errors.As(err, &limited) || limited.Delay() != 120*time.Second {
+		t.Errorf("Expected the registry to be blocked, got %v", err)
+	}
+
+	status := l.Status()
+	if len(status) != 1 || status[0].BlockedUntil == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	clock.now = clock.now.Add(121 * time.Second)
+	if status = l.Status(); status[0].BlockedUntil != nil {
+		t.Errorf("The registry should not be blocked anymore")
+	}
+}
+
+func TestRetryAfterWithoutLimit(t *testing.T) {
+	l, clock := newTestLimits()
+
+	// the registry does not advertise its limit
+	header := http.Header{}
+	header.Set("Retry-After", "10")
+	var limited *Error
+	if err := l.Observe("registry.local.lan", http.StatusTooManyRequests, header); !errors.As(err, &limited) {
+		t.Fatalf("Expected a rate limit error, got %v", err)
+	}
+	if err := l.Take("registry.local.lan"); !errors.As(err, &limited) {
+		t.Errorf("Expected the registry to be blocked, got %v", err)
+	}
+
+	clock.now = clock.now.Add(11 * time.Second)
+	if err := l.Take("registry.local.lan"); err != nil {
+		t.Errorf("The registry should not be blocked anymore: %v", err)
+	}
+	if err := l.Take("registry.local.lan"); err != nil {
+		t.Errorf("The registry should not be throttled: %v", err)
+	}
+
+	// without Retry-After the default delay is used
+	if err := l.Observe("registry.local.lan", http.StatusTooManyRequests, http.Header{}); !errors.As(err, &limited) || limited.Delay() != defaultRetryAfter {
+		t.Fatalf("Expected a rate limit error with the default delay, got %v", err)
+	}
+	clock.now = clock.now.Add(defaultRetryAfter)
+	if err := l.Take("registry.local.lan"); err != nil {
+		t.Errorf("The registry should not be blocked anymore: %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "50;w=21600")
+	}))
+	defer srv.Close()
+
+	l, _ := newTestLimits()
+	client := &http.Client{Transport: l.Transport("registry.local.lan", http.DefaultTransport)}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if status := l.Status(); len(status) != 1 || status[0].Remaining != 50 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	_, err = client.Get(srv.URL)
+	var limited *Error
+	if !errors.As(err, &limited) || limited.Registry != "registry.local.lan" {
+		t.Fatalf("Expected a rate limit error, got %v", err)
+	}
+
+	// the registry is not contacted while being blocked
+	if _, err = client.Get(srv.URL); !errors.As(err, &limited) || requests != 2 {
+		t.Errorf("Unexpected error %v after %d requests", err, requests)
+	}
+}
@@ -0,0 +1,243 @@
+// Package registries implements the subset of containers-registries.conf(5),
+// version 2, that is relevant to fresh-container: short name resolution,
+// registry mirrors, location rewrites and blocked registries.
+package registries
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	dockerHubDomain = "docker.io"
+
+	pullFromMirrorAll        = "all"
+	pullFromMirrorDigestOnly = "digest-only"
+	pullFromMirrorTagOnly    = "tag-only"
+)
+
+// Conf holds the contents of a registries.conf file
+type Conf struct {
+	UnqualifiedSearchRegistries []string          `toml:"unqualified-search-registries"`
+	Registries                  []Registry        `toml:"registry"`
+	Aliases                     map[string]string `toml:"aliases"`
+}
+
+// Registry is a `[[registry]]` entry
+type Registry struct {
+	Prefix             string   `toml:"prefix"`
+	Location           string   `toml:"location"`
+	Insecure           bool     `toml:"insecure"`
+	Blocked            bool     `toml:"blocked"`
+	MirrorByDigestOnly bool     `toml:"mirror-by-digest-only"`
+	Mirrors            []Mirror `toml:"mirror"`
+}
+
+// Mirror is a `[[registry.mirror]]` entry
+type Mirror struct {
+	Location       string `toml:"location"`
+	Insecure       bool   `toml:"insecure"`
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+// Location is a place where the tags of an image can be fetched from
+type Location struct {
+	Domain   string
+	Path     string
+	Insecure bool
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s/%s", l.Domain, l.Path)
+}
+
+// Load reads the registries.conf file stored at the given path
+func Load(path string) (*Conf, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, err := Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return conf, nil
+}
+
+// Parse parses the contents of a registries.conf file
+func Parse(data string) (*Conf, error) {
+	conf := &Conf{}
+	if _, err := toml.Decode(data, conf); err != nil {
+		return nil, err
+	}
+	if conf.Aliases == nil {
+		conf.Aliases = make(map[string]string)
+	}
+
+	for i := range conf.Registries {
+		reg := &conf.Registries[i]
+		if reg.Prefix == "" {
+			reg.Prefix = reg.Location
+		}
+		if reg.Prefix == "" {
+			return nil, fmt.Errorf("[[registry]] entries must have either a prefix or a location")
+		}
+
+		for _, mirror := range reg.Mirrors {
+			switch mirror.PullFromMirror {
+			case "", pullFromMirrorAll, pullFromMirrorDigestOnly, pullFromMirrorTagOnly:
+			default:
+				return nil, fmt.Errorf("invalid pull-from-mirror value %s", mirror.PullFromMirror)
+			}
+			if mirror.Location == "" {
+				return nil, fmt.Errorf("[[registry.mirror]] entries must have a location")
+			}
+		}
+	}
+
+	return conf, nil
+}
+
+// Resolve finds where the tags of the named image, given without its tag
+// or digest, can be fetched from.
+// Short names are expanded using the aliases or the unqualified search
+// registries. It returns the fully qualified name of the image together
+// with the ordered list of locations to query: the mirrors of the registry
+// come first, followed by the registry itself. Short names expanded through
+// multiple search registries get the locations of all of them.
+func (c *Conf) Resolve(name string) (string, []Location, error) {
+	candidates := []string{name}
+	if isShortName(name) {
+		if alias, found := c.Aliases[name]; found {
+			candidates = []string{alias}
+		} else if len(c.UnqualifiedSearchRegistries) > 0 {
+			candidates = []string{}
+			for _, search := range c.UnqualifiedSearchRegistries {
+				candidates = append(candidates, search+"/"+name)
+			}
+		} else {
+			candidates = []string{dockerHubDomain + "/" + name}
+		}
+	}
+
+	qualified := ""
+	locations := []Location{}
+	for _, candidate := range candidates {
+		candidate = normalizeDockerHub(candidate)
+
+		reg := c.findRegistry(candidate)
+		if reg != nil && reg.Blocked {
+			if len(candidates) == 1 {
+				return "", []Location{}, fmt.Errorf("The registry holding the %s image is blocked", candidate)
+			}
+			continue
+		}
+
+		if qualified == "" {
+			qualified = candidate
+		}
+		locations = append(locations, reg.locations(candidate)...)
+	}
+
+	if qualified == "" {
+		return "", []Location{}, fmt.Errorf("All the registries that could hold the %s image are blocked", name)
+	}
+
+	return qualified, locations, nil
+}
+
+// findRegistry returns the `[[registry]]` entry with the longest
+// prefix matching the image name, nil when none matches
+func (c *Conf) findRegistry(name string) *Registry {
+	var best *Registry
+	bestLength := -1
+	for i := range c.Registries {
+		reg := &c.Registries[i]
+		if matchesPrefix(name, reg.Prefix) && len(reg.Prefix) > bestLength {
+			best = reg
+			bestLength = len(reg.Prefix)
+		}
+	}
+	return best
+}
+
+// locations returns the places where the tags of the image, matched by the
+// registry, can be fetched from. A nil registry means no entry matched the
+// image, which is then fetched straight from its own registry.
+func (reg *Registry) locations(name string) []Location {
+	if reg == nil {
+		return []Location{newLocation(name, false)}
+	}
+
+	// The prefix matched by the entry is replaced by the location of the
+	// registry, or by the one of its mirrors
+	suffix := strings.TrimPrefix(name, reg.Prefix)
+	if strings.HasPrefix(reg.Prefix, "*.") {
+		suffix = strings.TrimPrefix(name, domainOf(name))
+	}
+
+	rewritten := name
+	if reg.Location != "" && !strings.HasPrefix(reg.Prefix, "*.") {
+		rewritten = normalizeDockerHub(reg.Location + suffix)
+	}
+
+	locations := []Location{}
+	if !reg.MirrorByDigestOnly {
+		for _, mirror := range reg.Mirrors {
+			// tags are listed, mirrors restricted to digests cannot be used
+			if mirror.PullFromMirror == pullFromMirrorDigestOnly {
+				continue
+			}
+			locations = append(locations, newLocation(mirror.Location+suffix, mirror.Insecure))
+		}
+	}
+
+	return append(locations, newLocation(rewritten, reg.Insecure))
+}
+
+func newLocation(name string, insecure bool) Location {
+	domain := domainOf(name)
+	return Location{
+		Domain:   domain,
+		Path:     strings.TrimPrefix(strings.TrimPrefix(name, domain), "/"),
+		Insecure: insecure,
+	}
+}
+
+// matchesPrefix implements the prefix matching rules of registries.conf:
+// the prefix must match whole path components, `*.example.com` prefixes
+// match all the subdomains of example.com
+func matchesPrefix(name, prefix string) bool {
+	if strings.HasPrefix(prefix, "*.") {
+		return strings.HasSuffix(domainOf(name), prefix[1:])
+	}
+
+	return name == prefix || strings.HasPrefix(name, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// isShortName returns true when the name does not start with a registry
+func isShortName(name string) bool {
+	if !strings.Contains(name, "/") {
+		return true
+	}
+	first := domainOf(name)
+	return !strings.ContainsAny(first, ".:") && first != "localhost"
+}
+
+func domainOf(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// normalizeDockerHub adds the `library` namespace used by the official
+// images hosted on Docker Hub
+func normalizeDockerHub(name string) string {
+	parts := strings.Split(name, "/")
+	if len(parts) == 2 && parts[0] == dockerHubDomain {
+		return dockerHubDomain + "/library/" + parts[1]
+	}
+	return name
+}
@@ -0,0 +1,193 @@
+package registries
+
+import (
+	"reflect"
+	"testing"
+)
+
+const registriesConf = `
+unqualified-search-registries = ["registry.local.lan", "quay.io"]
+
+[aliases]
+"app" = "quay.io/team/app"
+
+[[registry]]
+prefix = "docker.io"
+location = "docker.io"
+
+[[registry.mirror]]
+location = "mirror.local.lan:5000/hub"
+insecure = true
+
+[[registry.mirror]]
+location = "digests.local.lan"
+pull-from-mirror = "digest-only"
+
+[[registry]]
+prefix = "quay.io/team"
+location = "registry.local.lan/quay-team" # rewritten
+
+[[registry]]
+location = "registry.local.lan"
+blocked = true
+
+[[registry]]
+prefix = "*.blocked.lan"
+blocked = true
+`
+
+type ResolveTestCase struct {
+	Name              string
+	ExpectedQualified string
+	ExpectedLocations []Location
+}
+
+func TestResolve(t *testing.T) {
+	conf, err := Parse(registriesConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []ResolveTestCase{
+		ResolveTestCase{
+			Name:              "docker.io/nginx",
+			ExpectedQualified: "docker.io/library/nginx",
+			ExpectedLocations: []Location{
+				Location{Domain: "mirror.local.lan:5000", Path: "hub/library/nginx", Insecure: true},
+				Location{Domain: "docker.io", Path: "library/nginx"},
+			},
+		},
+		ResolveTestCase{
+			Name:              "app",
+			ExpectedQualified: "quay.io/team/app",
+			ExpectedLocations: []Location{
+				Location{Domain: "registry.local.lan", Path: "quay-team/app"},
+			},
+		},
+		ResolveTestCase{
+			// registry.local.lan is blocked, only quay.io is left
+			Name:              "tools/kubectl",
+			ExpectedQualified: "quay.io/tools/kubectl",
+			ExpectedLocations: []Location{
+				Location{Domain: "quay.io", Path: "tools/kubectl"},
+			},
+		},
+		ResolveTestCase{
+			Name:              "ghcr.io/owner/image",
+			ExpectedQualified: "ghcr.io/owner/image",
+			ExpectedLocations: []Location{
+				Location{Domain: "ghcr.io", Path: "owner/image"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		qualified, locations, err := conf.Resolve(tc.Name)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		if qualified != tc.ExpectedQualified {
+			t.Errorf("Unexpected qualified name for test case %+v, got %s", tc, qualified)
+		}
+		if !reflect.DeepEqual(locations, tc.ExpectedLocations) {
+			t.Errorf("Unexpected locations for test case %+v, got %+v", tc, locations)
+		}
+	}
+}
+
+func TestResolveBlocked(t *testing.T) {
+	conf, err := Parse(registriesConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"registry.local.lan/app", "images.blocked.lan/app"} {
+		if _, _, err := conf.Resolve(name); err == nil {
+			t.Errorf("Expected %s to be blocked", name)
+		}
+	}
+}
+
+func TestResolveWithoutConf(t *testing.T) {
+	conf := Conf{}
+
+	qualified, locations, err := conf.Resolve("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Location{Location{Domain: "docker.io", Path: "library/nginx"}}
+	if qualified != "docker.io/library/nginx" || !reflect.DeepEqual(locations, expected) {
+		t.Errorf("Unexpected resolution of nginx: %s %+v", qualified, locations)
+	}
+}
+
+// The whole TOML syntax is supported, together with the keys of
+// registries.conf that are not relevant to fresh-container
+const registriesConfSyntax = `
+short-name-mode = "enforcing"
+unqualified-search-registries = [
+  "registry.local.lan", # comment
+  "quay.io",
+]
+
+[aliases]
+app = "quay.io/team/app"
+
+[[registry]]
+location = "docker.io"
+mirror = [
+  { location = "mirror.local.lan:5000/hub", insecure = true },
+]
+
+[[registry]]
+prefix = "quay.io"
+location = "quay.io"
+retries.max = 3
+retries.delay = 10
+`
+
+func TestParseSyntax(t *testing.T) {
+	conf, err := Parse(registriesConfSyntax)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(conf.UnqualifiedSearchRegistries, []string{"registry.local.lan", "quay.io"}) {
+		t.Errorf("Unexpected search registries %+v", conf.UnqualifiedSearchRegistries)
+	}
+	if conf.Aliases["app"] != "quay.io/team/app" {
+		t.Errorf("Unexpected aliases %+v", conf.Aliases)
+	}
+
+	expected := []Registry{
+		Registry{
+			Prefix:   "docker.io",
+			Location: "docker.io",
+			Mirrors:  []Mirror{Mirror{Location: "mirror.local.lan:5000/hub", Insecure: true}},
+		},
+		Registry{Prefix: "quay.io", Location: "quay.io"},
+	}
+	if !reflect.DeepEqual(conf.Registries, expected) {
+		t.Errorf("Unexpected registries %+v", conf.Registries)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []string{
+		`unqualified-search-registries = "docker.io"`,
+		"[[registry]]\nlocation = \"docker.io\"\ninsecure = \"yes\"",
+		"[[registry]]\ninsecure = true",
+		"[[registry]]\nlocation = \"docker.io\"\n[[registry.mirror]]\ninsecure = true",
+		"[[registry]]\nlocation = \"docker.io\"\n[[registry.mirror]]\nlocation = \"mirror.local.lan\"\npull-from-mirror = \"never\"",
+		"[[registry]\nlocation = \"docker.io\"",
+	}
+
+	for _, data := range testCases {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("Expected failure parsing %q", data)
+		}
+	}
+}
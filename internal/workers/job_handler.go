@@ -1,97 +1,114 @@
 package workers
 
 import (
+	"github.com/flavio/fresh-container/internal/ratelimit"
 	"github.com/flavio/fresh-container/pkg/fresh_container"
 
 	"context"
 	"encoding/json"
+	"errors"
 	log "github.com/sirupsen/logrus"
 )
 
-func (w *BackgroundWorker) ProcessJob(ctx context.Context, id, img, constraint, tagPrefix string) error {
-	image, err := fresh_container.NewImage(img, tagPrefix)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"error":      err,
-		}).Error("worker.ProcessJob")
-		return err
+func (w *BackgroundWorker) ProcessJob(ctx context.Context, id string, request fresh_container.ImageUpgradeEvaluationRequest) error {
+	fields := log.Fields{
+		"id":         id,
+		"image":      request.Image,
+		"constraint": request.Constraint,
+		"policy":     request.Policy,
+		"tagPrefix":  request.TagPrefix,
+		"tagPattern": request.TagPattern,
+		"loose":      request.Loose,
+		"scheme":     request.Scheme,
+		"strategy":   request.Strategy,
+		"explain":    request.Explain,
+		"exclude":    request.Exclude,
+		"digest":     request.Digest,
+		"platform":   request.Platform,
 	}
 
-	// reach to external registry to fetch tags
-	if err = image.FetchTags(ctx, w.config); err != nil {
-		log.WithFields(log.Fields{
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"error":      err,
-		}).Error("worker.ProcessJob")
-		return err
-	}
-
-	// save tags into DB
-	tagsString := []string{}
-	for _, tag := range image.TagVersions {
-		tagsString = append(tagsString, tag.String())
-	}
-	if err = w.db.SetImageTags(image, tagsString); err != nil {
-		log.WithFields(log.Fields{
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"error":      err,
-		}).Error("worker.ProcessJob")
-		return err
+	var evaluation fresh_container.ImageUpgradeEvaluationResponse
+	var err error
+	if request.Digest {
+		evaluation, err = w.evalDigest(ctx, request, fields)
 	} else {
-		log.WithFields(log.Fields{
-			"action":     "save_tags",
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"tags":       tagsString,
-		}).Debug("worker.ProcessJob")
+		evaluation, err = w.evalTags(ctx, request, fields)
 	}
-
-	evaluation, err := image.EvalUpgrade(constraint)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"error":      err,
-		}).Error("worker.ProcessJob")
+		var limited *ratelimit.Error
+		if errors.As(err, &limited) {
+			// the queue retries the job once the delay is over
+			log.WithFields(fields).WithFields(log.Fields{
+				"registry": limited.Registry,
+				"delay":    limited.Delay().String(),
+			}).Warn("worker.ProcessJob: registry rate limit reached, delaying job")
+			return limited
+		}
+
+		log.WithFields(fields).WithFields(log.Fields{
+			"error_kind": fresh_container.ErrorKindOf(err),
+		}).WithError(err).Error("worker.ProcessJob")
 		return err
 	}
 
 	encodedResult, err := json.Marshal(evaluation)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"error":      err,
-		}).Error("worker.ProcessJob")
+		log.WithFields(fields).WithError(err).Error("worker.ProcessJob")
 		return err
 	}
 
 	if err = w.db.SetEvaluation(id, encodedResult); err != nil {
-		log.WithFields(log.Fields{
-			"id":         id,
-			"image":      img,
-			"constraint": constraint,
-			"tagPrefix":  tagPrefix,
-			"error":      err,
-		}).Error("worker.ProcessJob")
+		log.WithFields(fields).WithError(err).Error("worker.ProcessJob")
 		return err
 	}
 
 	return err
 }
+
+func (w *BackgroundWorker) evalTags(ctx context.Context, request fresh_container.ImageUpgradeEvaluationRequest, fields log.Fields) (fresh_container.ImageUpgradeEvaluationResponse, error) {
+	image, err := fresh_container.NewImageFromRequest(request, w.config)
+	if err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	// reach to external registry to fetch tags
+	if err = image.FetchTags(ctx, w.config); err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	// save tags into DB, as they have been fetched: other requests
+	// can use a different tag prefix or parsing mode
+	tagsString := image.TagNames()
+	if err = w.db.SetImageTags(image, tagsString); err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+	log.WithFields(fields).WithFields(log.Fields{
+		"action": "save_tags",
+		"tags":   tagsString,
+	}).Debug("worker.ProcessJob")
+
+	return image.Evaluate(ctx, w.config, request)
+}
+
+func (w *BackgroundWorker) evalDigest(ctx context.Context, request fresh_container.ImageUpgradeEvaluationRequest, fields log.Fields) (fresh_container.ImageUpgradeEvaluationResponse, error) {
+	image, err := fresh_container.NewDigestImage(request.Image, w.config)
+	if err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	// reach to external registry to resolve the digest of the tag
+	if err = image.FetchDigest(ctx, w.config); err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+
+	// save digest into DB
+	if err = w.db.SetImageDigest(image, image.TagDigest); err != nil {
+		return fresh_container.ImageUpgradeEvaluationResponse{}, err
+	}
+	log.WithFields(fields).WithFields(log.Fields{
+		"action":     "save_digest",
+		"tag_digest": image.TagDigest,
+	}).Debug("worker.ProcessJob")
+
+	return image.EvalDigestUpgrade()
+}
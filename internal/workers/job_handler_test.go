@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/db"
+	"github.com/flavio/fresh-container/pkg/fresh_container"
+	"github.com/flavio/fresh-container/pkg/registrytest"
+)
+
+func TestProcessJob(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.AddTags("team/app", "1.0.0", "1.1.0", "2.0.0", "latest")
+
+	cfg := reg.Config()
+
+	d, err := db.NewDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bw := NewBackgroungWorker(cfg, d)
+	bw.ctx = context.Background()
+
+	id, err := bw.AddJob(fresh_container.ImageUpgradeEvaluationRequest{
+		Image:      reg.Host() + "/team/app:1.0.0",
+		Constraint: "< 2.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if result, err = d.GetEvaluation(id); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("The evaluation has not been stored: %v", err)
+	}
+
+	var evaluation fresh_container.ImageUpgradeEvaluationResponse
+	if err = json.Unmarshal([]byte(result), &evaluation); err != nil {
+		t.Fatal(err)
+	}
+	if !evaluation.Stale || evaluation.NextVersion != "1.1.0" {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/flavio/fresh-container/internal/config"
 	"github.com/flavio/fresh-container/internal/db"
+	"github.com/flavio/fresh-container/pkg/fresh_container"
 
 	"github.com/google/uuid"
 	"github.com/vmihailenco/taskq/v2"
@@ -20,13 +21,13 @@ type BackgroundWorker struct {
 	task         *taskq.Task
 }
 
-func (w *BackgroundWorker) AddJob(image, constraint, tagPrefix string) (string, error) {
+func (w *BackgroundWorker) AddJob(request fresh_container.ImageUpgradeEvaluationRequest) (string, error) {
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return "", err
 	}
 
-	if err = w.queue.Add(w.task.WithArgs(w.ctx, id.String(), image, constraint, tagPrefix)); err != nil {
+	if err = w.queue.Add(w.task.WithArgs(w.ctx, id.String(), request)); err != nil {
 		return "", err
 	}
 	if err := w.db.SetJobQueued(id.String()); err != nil {
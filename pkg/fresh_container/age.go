@@ -0,0 +1,162 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+const ociCreatedLabel = "org.opencontainers.image.created"
+
+// Platform whose image is inspected when a tag publishes a manifest
+// list and no platform has been requested
+var defaultAgePlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// ParseAge parses durations like `90d`, `12w` or `1y`. Besides days,
+// weeks and years, all the units understood by `time.ParseDuration`
+// are accepted.
+func ParseAge(age string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+
+	for suffix, unit := range units {
+		if !strings.HasSuffix(age, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(age, suffix))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("Invalid age %s", age)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(age)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid age %s", age)
+	}
+	return d, nil
+}
+
+// EvalAge adds the creation dates of the current and of the next tag
+// to the evaluation. When the current tag has been built more than
+// `maxAge` ago the image is flagged as stale, even if no newer tag
+// satisfies the constraint.
+// The image published for the given platform is inspected when the tags
+// are manifest lists. Without a platform, `linux/amd64` is preferred.
+func (image *Image) EvalAge(ctx context.Context, cfg *config.Config, evaluation *ImageUpgradeEvaluationResponse, maxAge time.Duration, platform *Platform) error {
+	return image.withRegistry(ctx, cfg, func(r *registry.Registry, location registries.Location) error {
+		current, err := creationTime(ctx, r, location.Path, image.Tag, platform)
+		if err != nil {
+			return err
+		}
+		evaluation.CurrentCreated = current
+
+		if evaluation.Stale {
+			next, err := creationTime(ctx, r, location.Path, image.TagPrefix+evaluation.NextVersion, platform)
+			if err != nil {
+				return err
+			}
+			evaluation.NextCreated = next
+		} else {
+			evaluation.NextCreated = current
+		}
+
+		if current != nil && isOlderThan(*current, maxAge, time.Now()) {
+			log.WithFields(log.Fields{
+				"image":   image.FullNameWithTag(),
+				"created": current.Format(time.RFC3339),
+				"max_age": maxAge.String(),
+			}).Debug("The current tag exceeds the max age")
+			evaluation.MaxAgeExceeded = true
+			evaluation.Stale = true
+		}
+
+		return nil
+	})
+}
+
+func isOlderThan(created time.Time, maxAge time.Duration, now time.Time) bool {
+	return maxAge > 0 && now.Sub(created) > maxAge
+}
+
+// creationTime returns the date the image published by the tag has been
+// built, nil when it cannot be found. Both the `created` field of the
+// image configuration and the `org.opencontainers.image.created` label
+// are looked up, the most recent one is used: reproducible builds often
+// set the former to the epoch.
+func creationTime(ctx context.Context, r *registry.Registry, repository, tag string, platform *Platform) (*time.Time, error) {
+	m, err := fetchManifest(ctx, r, repository, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Manifests) > 0 {
+		digest := m.platformDigest(platform)
+		if digest == "" {
+			return nil, fmt.Errorf("The %s tag does not publish an image for the requested platform", tag)
+		}
+
+		if m, err = fetchManifest(ctx, r, repository, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	imgConfig, err := fetchImageConfig(ctx, r, repository, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return imgConfig.creationTime(), nil
+}
+
+// platformDigest returns the digest of the manifest published for the
+// platform by a manifest list. Without a platform, the `linux/amd64` image
+// is preferred, falling back to the first image of the list.
+func (m *manifest) platformDigest(platform *Platform) string {
+	wanted := platform
+	if wanted == nil {
+		wanted = &defaultAgePlatform
+	}
+
+	fallback := ""
+	for _, entry := range m.Manifests {
+		if entry.Platform.Satisfies(*wanted) {
+			return entry.Digest
+		}
+		// skip attestations and other artifacts that are not images
+		if fallback == "" && entry.Platform.OS != "" && entry.Platform.OS != "unknown" {
+			fallback = entry.Digest
+		}
+	}
+
+	if platform != nil {
+		return ""
+	}
+	return fallback
+}
+
+func (c *imageConfig) creationTime() *time.Time {
+	var created *time.Time
+	if c.Created != nil && c.Created.Unix() > 0 {
+		created = c.Created
+	}
+
+	if label, found := c.Config.Labels[ociCreatedLabel]; found {
+		t, err := time.Parse(time.RFC3339, label)
+		if err == nil && t.Unix() > 0 && (created == nil || t.After(*created)) {
+			created = &t
+		}
+	}
+
+	return created
+}
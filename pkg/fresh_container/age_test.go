@@ -0,0 +1,86 @@
+package fresh_container
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type ParseAgeTestCase struct {
+	Age         string
+	Expected    time.Duration
+	ExpectError bool
+}
+
+func TestParseAge(t *testing.T) {
+	testCases := []ParseAgeTestCase{
+		ParseAgeTestCase{Age: "90d", Expected: 90 * 24 * time.Hour},
+		ParseAgeTestCase{Age: "2w", Expected: 14 * 24 * time.Hour},
+		ParseAgeTestCase{Age: "1y", Expected: 365 * 24 * time.Hour},
+		ParseAgeTestCase{Age: "36h", Expected: 36 * time.Hour},
+		ParseAgeTestCase{Age: "d", ExpectError: true},
+		ParseAgeTestCase{Age: "-3d", ExpectError: true},
+		ParseAgeTestCase{Age: "1.5d", ExpectError: true},
+		ParseAgeTestCase{Age: "soon", ExpectError: true},
+	}
+
+	for _, tc := range testCases {
+		age, err := ParseAge(tc.Age)
+		if tc.ExpectError {
+			if err == nil {
+				t.Errorf("Expected failure parsing %s", tc.Age)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if age != tc.Expected {
+			t.Errorf("Unexpected age for test case %+v, got %s", tc, age)
+		}
+	}
+}
+
+type CreationTimeTestCase struct {
+	Config   string
+	Expected string
+}
+
+func TestImageConfigCreationTime(t *testing.T) {
+	testCases := []CreationTimeTestCase{
+		CreationTimeTestCase{
+			Config:   `{"created": "2020-05-01T10:00:00Z"}`,
+			Expected: "2020-05-01T10:00:00Z",
+		},
+		CreationTimeTestCase{
+			// reproducible build: the label holds the real date
+			Config:   `{"created": "1970-01-01T00:00:00Z", "config": {"Labels": {"org.opencontainers.image.created": "2021-03-04T05:06:07Z"}}}`,
+			Expected: "2021-03-04T05:06:07Z",
+		},
+		CreationTimeTestCase{
+			Config:   `{"created": "2021-03-04T05:06:07Z", "config": {"Labels": {"org.opencontainers.image.created": "not a date"}}}`,
+			Expected: "2021-03-04T05:06:07Z",
+		},
+		CreationTimeTestCase{
+			Config:   `{}`,
+			Expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		var c imageConfig
+		if err := json.Unmarshal([]byte(tc.Config), &c); err != nil {
+			t.Fatal(err)
+		}
+
+		created := c.creationTime()
+		got := ""
+		if created != nil {
+			got = created.Format(time.RFC3339)
+		}
+		if got != tc.Expected {
+			t.Errorf("Unexpected creation time for test case %+v, got %s", tc, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package fresh_container
+
+import (
+	"context"
+
+	"github.com/blang/semver"
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+)
+
+// candidateFilter tells whether the tag can be recommended. The current
+// tag is always kept: the filters are run against it only to collect
+// information about it, in that case `current` is true.
+type candidateFilter func(r *registry.Registry, location registries.Location, tag string, current bool) (bool, error)
+
+// nextFilteredVersion behaves like NextVersion, but the recommended tag
+// must be accepted by all the filters. Starting from the version picked
+// by the upgrade strategy, the candidates are inspected one after the
+// other until one of them passes all the filters.
+// The registry is not queried when there are no filters.
+func (image *Image) nextFilteredVersion(ctx context.Context, cfg *config.Config, constraintRange semver.Range, filters ...candidateFilter) (semver.Version, error) {
+	if len(filters) == 0 {
+		return nextVersion(image.versionScheme(), image.TagVersion, constraintRange, image.TagVersions, image.Strategy, image.explanation), nil
+	}
+
+	var nextVer semver.Version
+	err := image.withRegistry(ctx, cfg, func(r *registry.Registry, location registries.Location) error {
+		candidates := append(semver.Versions{}, image.TagVersions...)
+		for {
+			nextVer = nextVersion(image.versionScheme(), image.TagVersion, constraintRange, candidates, image.Strategy, image.explanation)
+			current := image.compareVersions(nextVer, image.TagVersion) <= 0
+			tag := image.Tag
+			if !current {
+				tag = image.tagName(nextVer)
+			}
+
+			accepted := true
+			for _, filter := range filters {
+				ok, err := filter(r, location, tag, current)
+				if err != nil {
+					return err
+				}
+				if !ok && !current {
+					accepted = false
+					break
+				}
+			}
+
+			if accepted {
+				return nil
+			}
+			candidates = removeVersion(image.versionScheme(), candidates, nextVer)
+		}
+	})
+
+	return nextVer, err
+}
@@ -0,0 +1,104 @@
+package fresh_container
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// circuitBreaker stops contacting a registry after too many consecutive
+// failures. Once the cooldown is over a single request is let through:
+// its success closes the circuit, its failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	registry  string
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// The circuit breakers are shared by all the registry clients
+var circuitBreakers = struct {
+	sync.Mutex
+	byRegistry map[string]*circuitBreaker
+}{
+	byRegistry: make(map[string]*circuitBreaker),
+}
+
+// circuitBreakerFor returns the circuit breaker of the registry,
+// a threshold lower or equal to 0 disables it
+func circuitBreakerFor(registry string, threshold int, cooldown time.Duration) *circuitBreaker {
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+
+	cb, found := circuitBreakers.byRegistry[registry]
+	if !found {
+		cb = newCircuitBreaker(registry, threshold, cooldown)
+		circuitBreakers.byRegistry[registry] = cb
+	}
+
+	cb.mu.Lock()
+	cb.threshold = threshold
+	cb.cooldown = cooldown
+	cb.mu.Unlock()
+
+	return cb
+}
+
+func newCircuitBreaker(registry string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		registry:  registry,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns false, together with the time the registry can be
+// contacted again, when the circuit is open
+func (cb *circuitBreaker) allow() (bool, time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.threshold <= 0 || cb.failures < cb.threshold {
+		return true, time.Time{}
+	}
+	if cb.now().Before(cb.openUntil) {
+		return false, cb.openUntil
+	}
+
+	// let a single request through, the circuit opens again
+	// until it completes
+	cb.openUntil = cb.now().Add(cb.cooldown)
+	return true, time.Time{}
+}
+
+func (cb *circuitBreaker) success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.openUntil = time.Time{}
+}
+
+func (cb *circuitBreaker) failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.threshold <= 0 || cb.failures < cb.threshold {
+		return
+	}
+
+	cb.openUntil = cb.now().Add(cb.cooldown)
+	if cb.failures == cb.threshold {
+		log.WithFields(log.Fields{
+			"registry": cb.registry,
+			"failures": cb.failures,
+			"cooldown": cb.cooldown.String(),
+		}).Warn("Too many consecutive failures, the registry is not going to be contacted for a while")
+	}
+}
@@ -20,7 +20,7 @@ func NewClient(server string) Client {
 	}
 }
 
-func (c *Client) EvalUpgrade(image, constraint, tagPrefix string) (RemoteEvaluationResponse, error) {
+func (c *Client) EvalUpgrade(request ImageUpgradeEvaluationRequest) (RemoteEvaluationResponse, error) {
 	u, err := url.Parse(c.Server)
 	if err != nil {
 		return RemoteEvaluationResponse{}, err
@@ -28,10 +28,45 @@ func (c *Client) EvalUpgrade(image, constraint, tagPrefix string) (RemoteEvaluat
 
 	u.Path = "/api/v1/check"
 	q := u.Query()
-	q.Add("image", image)
-	q.Add("constraint", constraint)
-	if tagPrefix != "" {
-		q.Add("tagPrefix", tagPrefix)
+	q.Add("image", request.Image)
+	if request.Constraint != "" {
+		q.Add("constraint", request.Constraint)
+	}
+	if request.Policy != "" {
+		q.Add("policy", request.Policy)
+	}
+	if request.TagPrefix != "" {
+		q.Add("tagPrefix", request.TagPrefix)
+	}
+	if request.TagPattern != "" {
+		q.Add("tagPattern", request.TagPattern)
+	}
+	if request.Loose {
+		q.Add("loose", "true")
+	}
+	if request.Scheme != "" {
+		q.Add("scheme", request.Scheme)
+	}
+	if request.Strategy != "" {
+		q.Add("strategy", request.Strategy)
+	}
+	if request.Explain {
+		q.Add("explain", "true")
+	}
+	for _, exclude := range request.Exclude {
+		q.Add("exclude", exclude)
+	}
+	if request.Digest {
+		q.Add("digest", "true")
+	}
+	if request.Platform != "" {
+		q.Add("platform", request.Platform)
+	}
+	if request.MaxAge != "" {
+		q.Add("maxAge", request.MaxAge)
+	}
+	if request.MinReleaseAge != "" {
+		q.Add("minReleaseAge", request.MinReleaseAge)
 	}
 	u.RawQuery = q.Encode()
 
@@ -41,11 +76,22 @@ func (c *Client) EvalUpgrade(image, constraint, tagPrefix string) (RemoteEvaluat
 	}
 
 	log.WithFields(log.Fields{
-		"image":      image,
-		"constraint": constraint,
-		"tagPrefix":  tagPrefix,
-		"resp-code":  resp.Status,
-		"headers":    resp.Header,
+		"image":         request.Image,
+		"constraint":    request.Constraint,
+		"policy":        request.Policy,
+		"tagPrefix":     request.TagPrefix,
+		"tagPattern":    request.TagPattern,
+		"loose":         request.Loose,
+		"scheme":        request.Scheme,
+		"strategy":      request.Strategy,
+		"explain":       request.Explain,
+		"exclude":       request.Exclude,
+		"digest":        request.Digest,
+		"platform":      request.Platform,
+		"maxAge":        request.MaxAge,
+		"minReleaseAge": request.MinReleaseAge,
+		"resp-code":     resp.Status,
+		"headers":       resp.Header,
 	}).Debug("Remote evaluation response")
 
 	switch resp.StatusCode {
@@ -13,7 +13,7 @@ func NextTag(curTag, constraint, tagPrefix string, tags []string) (string, error
 		return "", err
 	}
 
-	constraintRange, err := semver.ParseRange(constraint)
+	constraintRange, err := ParseConstraint(constraint)
 	if err != nil {
 		return "", err
 	}
@@ -28,29 +28,101 @@ func NextTag(curTag, constraint, tagPrefix string, tags []string) (string, error
 	return nextVer.String(), nil
 }
 
+// NextVersion returns the highest semver version satisfying the
+// constraint, see `FindNextVersion`. The tag prefix is ignored, it is
+// kept for compatibility.
 func NextVersion(curVer semver.Version, constraintRange semver.Range, tagPrefix string, versions semver.Versions) semver.Version {
-	nextVer := curVer
+	return FindNextVersion(curVer, constraintRange, versions, NextVersionOptions{})
+}
+
+// NextVersionOptions tunes the lookup of the next version
+type NextVersionOptions struct {
+	// Ordering of the versions, `SemverScheme` when nil
+	Scheme VersionScheme
+	// Version recommended among the candidates, `StrategyLatest`
+	// when empty
+	Strategy UpgradeStrategy
+}
+
+// FindNextVersion returns the version, picked by the strategy, among
+// the ones greater than the current version that satisfy the constraint and whose flavor
+// belongs to the family of the current one, see `Flavor`.
+// The current version is returned when none is greater.
+// The constraint applies to the versions without their flavor, which
+// are ordered by the scheme, then by the version of their flavor.
+func FindNextVersion(curVer semver.Version, constraintRange semver.Range, versions semver.Versions, options NextVersionOptions) semver.Version {
+	scheme := options.Scheme
+	if scheme == nil {
+		scheme = SemverScheme{}
+	}
+	return nextVersion(scheme, curVer, constraintRange, versions, options.Strategy, nil)
+}
+
+// nextVersion behaves like `FindNextVersion`, the reasons why the
+// versions are recommended or not are recorded into the explanation
+func nextVersion(scheme VersionScheme, curVer semver.Version, constraintRange semver.Range, versions semver.Versions, strategy UpgradeStrategy, e *explanation) semver.Version {
+	current := ParseFlavor(curVer)
+	candidates := semver.Versions{}
 	for _, v := range versions {
-		if constraintRange(v) {
-			if v.GTE(nextVer) && samePre(v, nextVer) {
-				nextVer = v
-			}
+		flavor := ParseFlavor(v)
+		switch {
+		case compareFlavored(scheme, v, curVer) == 0 && flavor.Family == current.Family:
+			e.recordVersion(v, true, "current version")
+		case flavor.Family != current.Family:
+			e.recordVersion(v, false, "flavor family %q differs from the %q one of the current tag", flavor.Family, current.Family)
+		case compareFlavored(scheme, v, curVer) < 0:
+			e.recordVersion(v, false, "older than the current version")
+		case !constraintRange(withoutPre(v)):
+			e.recordVersion(v, false, "does not satisfy the constraint")
+		default:
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return curVer
+	}
+
+	nextVer := strategy.pick(scheme, curVer, candidates)
+	for _, v := range candidates {
+		if scheme.Compare(v, nextVer) == 0 {
+			e.recordVersion(v, true, "recommended")
+		} else {
+			e.recordVersion(v, false, "newer, but not picked by the %s strategy", strategy.name())
 		}
 	}
 
 	return nextVer
 }
 
-func samePre(v1, v2 semver.Version) bool {
-	if len(v1.Pre) != len(v2.Pre) {
-		return false
-	}
+// LatestVersions holds the highest versions available around the
+// current one, regardless of the constraint
+type LatestVersions struct {
+	// Same major and minor components as the current version
+	Patch semver.Version
+	// Same major component as the current version
+	Minor semver.Version
+	// Any version
+	Major semver.Version
+	// Any version, the same as `Major`: the tags of other flavor
+	// families are not upgrade targets, they are ignored here too
+	Overall semver.Version
+}
 
-	for i := 0; i < len(v1.Pre); i++ {
-		if v1.Pre[i].Compare(v2.Pre[i]) != 0 {
-			return false
-		}
-	}
+// FindLatestVersions returns the highest versions sharing the major and
+// minor components, or only the major one, with the current version and
+// the highest version overall. Like `FindNextVersion`, only the versions
+// whose flavor belongs to the family of the current one are considered.
+// The current version is returned when none is greater.
+func FindLatestVersions(scheme VersionScheme, curVer semver.Version, versions semver.Versions) LatestVersions {
+	samePatch := func(v semver.Version) bool { return sameMinor(v, curVer) }
+	sameMajor := func(v semver.Version) bool { return v.Major == curVer.Major }
 
-	return true
+	major := FindNextVersion(curVer, anyVersion, versions, NextVersionOptions{Scheme: scheme})
+
+	return LatestVersions{
+		Patch:   FindNextVersion(curVer, samePatch, versions, NextVersionOptions{Scheme: scheme}),
+		Minor:   FindNextVersion(curVer, sameMajor, versions, NextVersionOptions{Scheme: scheme}),
+		Major:   major,
+		Overall: major,
+	}
 }
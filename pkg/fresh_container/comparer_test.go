@@ -2,6 +2,8 @@ package fresh_container
 
 import (
 	"testing"
+
+	"github.com/blang/semver"
 )
 
 func TestNextReleaseInvalidConstraint(t *testing.T) {
@@ -11,6 +13,14 @@ func TestNextReleaseInvalidConstraint(t *testing.T) {
 	}
 }
 
+func TestNextReleaseUnparsableConstraint(t *testing.T) {
+	// the version is valid, only the constraint can be rejected
+	_, err := NextTag("1.1.0", ">>> foo", "", []string{})
+	if err == nil {
+		t.Error("Expected failure parsing invalid constraint")
+	}
+}
+
 func TestNextReleaseInvalidVersion(t *testing.T) {
 	_, err := NextTag("1.1", "> 1.1.0", "", []string{})
 	if err == nil {
@@ -134,6 +144,33 @@ func TestNextTag(t *testing.T) {
 			TagPrefix:   "alpine-",
 			ExpectedTag: "1.3.1",
 		},
+		NextTagTestCase{
+			// the version of the flavor moves too
+			CurTag:     "14.5.0-alpine3.16",
+			Constraint: ">= 14.0.0 < 15.0.0",
+			Tags: []string{
+				"14.5.0",
+				"14.5.0-alpine3.16",
+				"14.9.0-alpine3.9",
+				"14.9.0-alpine3.18",
+				"14.9.0-bullseye",
+				"14.10.0",
+				"15.1.0-alpine3.18",
+			},
+			ExpectedTag: "14.9.0-alpine3.18",
+		},
+		NextTagTestCase{
+			// the flavor versions are compared as numbers
+			CurTag:     "1.2.3-jdk8-slim",
+			Constraint: ">= 1.0.0 < 2.0.0",
+			Tags: []string{
+				"1.2.3-jdk8-slim",
+				"1.2.3-jdk17-slim",
+				"1.2.3-jdk11-slim",
+				"1.2.3-jdk17",
+			},
+			ExpectedTag: "1.2.3-jdk17-slim",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -150,3 +187,170 @@ func TestNextTag(t *testing.T) {
 		}
 	}
 }
+
+type NextVersionStrategyTestCase struct {
+	Strategy    UpgradeStrategy
+	CurTag      string
+	Constraint  string
+	Tags        []string
+	ExpectedTag string
+}
+
+func TestNextVersionStrategy(t *testing.T) {
+	tags := []string{
+		"1.4.0",
+		"1.5.0",
+		"1.5.1",
+		"1.5.2",
+		"1.6.0",
+		"1.6.4",
+		"1.6.5-alpine",
+		"1.7.1",
+		"2.0.0",
+	}
+
+	testCases := []NextVersionStrategyTestCase{
+		NextVersionStrategyTestCase{Strategy: StrategyLatest, CurTag: "1.5.0", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.7.1"},
+		NextVersionStrategyTestCase{Strategy: "", CurTag: "1.5.0", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.7.1"},
+		NextVersionStrategyTestCase{Strategy: StrategyNearest, CurTag: "1.5.0", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.5.1"},
+		NextVersionStrategyTestCase{Strategy: StrategyNearest, CurTag: "1.5.2", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.6.0"},
+		NextVersionStrategyTestCase{Strategy: StrategyNearest, CurTag: "1.7.1", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.7.1"},
+		NextVersionStrategyTestCase{Strategy: StrategyNearest, CurTag: "1.5.0", Constraint: ">= 1.6.0", Tags: tags, ExpectedTag: "1.6.0"},
+		NextVersionStrategyTestCase{Strategy: StrategyNextMinorLatestPatch, CurTag: "1.5.0", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.6.4"},
+		NextVersionStrategyTestCase{Strategy: StrategyNextMinorLatestPatch, CurTag: "1.6.0", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.7.1"},
+		// the next minor version can belong to the next major one
+		NextVersionStrategyTestCase{Strategy: StrategyNextMinorLatestPatch, CurTag: "1.7.1", Constraint: "*", Tags: tags, ExpectedTag: "2.0.0"},
+		// no newer minor version, the latest patch of the current one
+		NextVersionStrategyTestCase{Strategy: StrategyNextMinorLatestPatch, CurTag: "1.6.0", Constraint: "< 1.7.0", Tags: tags, ExpectedTag: "1.6.4"},
+		// only the tags of the current flavor are considered
+		NextVersionStrategyTestCase{Strategy: StrategyNextMinorLatestPatch, CurTag: "1.5.0-alpine", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.6.5-alpine"},
+		NextVersionStrategyTestCase{Strategy: StrategyNearest, CurTag: "1.5.0-alpine", Constraint: "< 2.0.0", Tags: tags, ExpectedTag: "1.6.5-alpine"},
+	}
+
+	for _, tc := range testCases {
+		curVer, err := ParseTag(tc.CurTag, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		constraintRange, err := ParseConstraint(tc.Constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions, err := TagsToVersions(tc.Tags, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nextVer := FindNextVersion(curVer, constraintRange, versions, NextVersionOptions{Strategy: tc.Strategy})
+		if nextVer.String() != tc.ExpectedTag {
+			t.Errorf("Unexpected next version for test case %+v, got %s instead of %s",
+				tc,
+				nextVer,
+				tc.ExpectedTag)
+		}
+	}
+
+	if _, err := ParseUpgradeStrategy("oldest"); err == nil {
+		t.Error("Expected failure parsing an unknown strategy")
+	}
+}
+
+type LatestVersionsTestCase struct {
+	CurTag          string
+	Tags            []string
+	ExpectedPatch   string
+	ExpectedMinor   string
+	ExpectedMajor   string
+	ExpectedOverall string
+}
+
+func TestFindLatestVersions(t *testing.T) {
+	testCases := []LatestVersionsTestCase{
+		LatestVersionsTestCase{
+			// other flavors are ignored
+			CurTag:          "1.9.3",
+			Tags:            []string{"1.9.3", "1.9.7", "1.10.2", "2.0.0", "2.1.0-alpine"},
+			ExpectedPatch:   "1.9.7",
+			ExpectedMinor:   "1.10.2",
+			ExpectedMajor:   "2.0.0",
+			ExpectedOverall: "2.0.0",
+		},
+		LatestVersionsTestCase{
+			// nothing newer
+			CurTag:          "2.0.0",
+			Tags:            []string{"1.9.3", "2.0.0"},
+			ExpectedPatch:   "2.0.0",
+			ExpectedMinor:   "2.0.0",
+			ExpectedMajor:   "2.0.0",
+			ExpectedOverall: "2.0.0",
+		},
+		LatestVersionsTestCase{
+			CurTag:          "14.5.0-alpine3.16",
+			Tags:            []string{"14.5.0-alpine3.18", "14.9.0-alpine3.16", "14.9.0", "15.1.0-bullseye"},
+			ExpectedPatch:   "14.5.0-alpine3.18",
+			ExpectedMinor:   "14.9.0-alpine3.16",
+			ExpectedMajor:   "14.9.0-alpine3.16",
+			ExpectedOverall: "14.9.0-alpine3.16",
+		},
+	}
+
+	for _, tc := range testCases {
+		curVer, err := ParseTag(tc.CurTag, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions, err := TagsToVersions(tc.Tags, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		latest := FindLatestVersions(SemverScheme{}, curVer, versions)
+		if latest.Patch.String() != tc.ExpectedPatch ||
+			latest.Minor.String() != tc.ExpectedMinor ||
+			latest.Major.String() != tc.ExpectedMajor ||
+			latest.Overall.String() != tc.ExpectedOverall {
+			t.Errorf("Unexpected latest versions for test case %+v, got %+v", tc, latest)
+		}
+	}
+}
+
+func TestFindNextVersion(t *testing.T) {
+	versions, err := TagsToVersions([]string{"1.0.0", "1.2.0", "1.10.0", "2.0.0"}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraintRange, err := ParseConstraint("< 2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	curVer := semver.MustParse("1.0.0")
+
+	// the signature used before the version schemes were introduced
+	if nextVer := NextVersion(curVer, constraintRange, "", versions); nextVer.String() != "1.10.0" {
+		t.Errorf("Unexpected next version %s", nextVer)
+	}
+	if nextVer := FindNextVersion(curVer, constraintRange, versions, NextVersionOptions{}); nextVer.String() != "1.10.0" {
+		t.Errorf("Unexpected next version %s", nextVer)
+	}
+
+	scheme, err := NewVersionScheme(SchemeCalver, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calverVersions := semver.Versions{}
+	for _, tag := range []string{"2023.12", "2024.01", "2024.02"} {
+		v, err := scheme.Parse(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calverVersions = append(calverVersions, v)
+	}
+	calverRange, err := scheme.ParseConstraint("< 2024.02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextVer := FindNextVersion(calverVersions[0], calverRange, calverVersions, NextVersionOptions{Scheme: scheme})
+	if scheme.Format(nextVer) != "2024.01" {
+		t.Errorf("Unexpected next version %s", scheme.Format(nextVer))
+	}
+}
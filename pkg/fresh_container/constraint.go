@@ -0,0 +1,371 @@
+package fresh_container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+var (
+	// Longest operators first, `>=` must not be read as `>`
+	rangeOperators = []string{"~>", ">=", "<=", "!=", "==", "^", "~", ">", "<", "=", "!"}
+)
+
+// ParseConstraint parses semver constraints written using the npm and
+// Cargo grammar, which extends the one of the blang/semver library:
+//
+//   - `^1.9`: compatible versions, `>= 1.9.0 < 2.0.0`
+//   - `~1.9.0`: patch releases, `>= 1.9.0 < 1.10.0`
+//   - `1.9.x`, `1.9.*` or `1.9`: wildcards, `>= 1.9.0 < 1.10.0`
+//   - `1.9.0 - 1.10.0`: hyphen ranges, `>= 1.9.0 <= 1.10.0`
+//
+// Comparisons separated by spaces or commas must all be satisfied,
+// `||` separates alternatives and parentheses group them.
+func ParseConstraint(constraint string) (semver.Range, error) {
+	return parseConstraint(SemverScheme{}, constraint)
+}
+
+// parseConstraint parses a constraint whose versions follow the scheme,
+// all the schemes share the grammar of `ParseConstraint`
+func parseConstraint(scheme VersionScheme, constraint string) (semver.Range, error) {
+	replacer := strings.NewReplacer("(", " ( ", ")", " ) ", "||", " || ", ",", " , ")
+	p := constraintParser{scheme: scheme, tokens: strings.Fields(replacer.Replace(constraint))}
+
+	r, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid constraint %s: %v", constraint, err)
+	}
+
+	return r, nil
+}
+
+type constraintParser struct {
+	scheme VersionScheme
+	tokens []string
+	pos    int
+}
+
+func (p *constraintParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *constraintParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *constraintParser) parseOr() (semver.Range, error) {
+	r, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.next()
+		alternative, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		r = r.OR(alternative)
+	}
+
+	return r, nil
+}
+
+func (p *constraintParser) parseAnd() (semver.Range, error) {
+	var r semver.Range
+	for {
+		switch p.peek() {
+		case ",":
+			p.next()
+			continue
+		case "", "||", ")":
+			if r == nil {
+				return nil, fmt.Errorf("empty comparison")
+			}
+			return r, nil
+		}
+
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			r = term
+		} else {
+			r = r.AND(term)
+		}
+	}
+}
+
+func (p *constraintParser) parseTerm() (semver.Range, error) {
+	token := p.next()
+	if token == "(" {
+		r, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return r, nil
+	}
+
+	operator := ""
+	for _, op := range rangeOperators {
+		if strings.HasPrefix(token, op) {
+			operator = op
+			break
+		}
+	}
+	version := strings.TrimPrefix(token, operator)
+	if version == "" {
+		// the operator is separated from the version
+		version = p.next()
+	}
+	if version == "" || strings.ContainsAny(version, "(),|") {
+		return nil, fmt.Errorf("missing version after %s", operator)
+	}
+
+	lower, err := p.parseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	if operator == "" && p.peek() == "-" {
+		p.next()
+		upper, err := p.parseVersion(p.next())
+		if err != nil {
+			return nil, err
+		}
+		return hyphenRange(lower, upper), nil
+	}
+
+	return lower.comparison(operator), nil
+}
+
+func (p *constraintParser) parseVersion(s string) (partialVersion, error) {
+	if _, ok := p.scheme.(SemverScheme); ok {
+		return parsePartialVersion(s)
+	}
+	return parseSchemeVersion(p.scheme, s)
+}
+
+// partialVersion is a version whose last components can be omitted or
+// replaced by the `x`, `X` and `*` wildcards
+type partialVersion struct {
+	scheme VersionScheme
+	// Components that have been specified
+	parts []uint64
+	// All the components of the version have been specified
+	complete bool
+	pre      []semver.PRVersion
+}
+
+func parsePartialVersion(s string) (partialVersion, error) {
+	version := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.Index(version, "+"); i >= 0 {
+		// the build metadata does not affect the comparisons
+		version = version[:i]
+	}
+
+	pv := partialVersion{scheme: SemverScheme{}}
+	if i := strings.Index(version, "-"); i >= 0 {
+		for _, p := range strings.Split(version[i+1:], ".") {
+			prVersion, err := semver.NewPRVersion(p)
+			if err != nil {
+				return partialVersion{}, fmt.Errorf("invalid version %s: %v", s, err)
+			}
+			pv.pre = append(pv.pre, prVersion)
+		}
+		version = version[:i]
+	}
+
+	components := strings.Split(version, ".")
+	if len(components) > 3 {
+		return partialVersion{}, fmt.Errorf("invalid version %s: too many components", s)
+	}
+	parts, err := parseComponents(components)
+	if err != nil {
+		return partialVersion{}, fmt.Errorf("invalid version %s", s)
+	}
+	pv.parts = parts
+	pv.complete = len(parts) == 3
+	if len(pv.pre) > 0 && !pv.complete {
+		return partialVersion{}, fmt.Errorf("invalid version %s: pre-releases require all the components", s)
+	}
+
+	return pv, nil
+}
+
+// parseSchemeVersion parses a version following the scheme, or numbers
+// separated by dots whose last ones are wildcards, e.g. `2024.x` for
+// a calendar version
+func parseSchemeVersion(scheme VersionScheme, s string) (partialVersion, error) {
+	components := strings.Split(s, ".")
+	if !isWildcard(components[len(components)-1]) {
+		v, err := scheme.Parse(s)
+		if err != nil {
+			return partialVersion{}, err
+		}
+		return partialVersion{scheme: scheme, parts: numericParts(v), complete: true, pre: v.Pre}, nil
+	}
+
+	parts, err := parseComponents(components)
+	if err != nil {
+		return partialVersion{}, fmt.Errorf("invalid version %s", s)
+	}
+	return partialVersion{scheme: scheme, parts: parts}, nil
+}
+
+// parseComponents parses the numeric components of a version, the last
+// ones can be replaced by wildcards, which are not returned
+func parseComponents(components []string) ([]uint64, error) {
+	parts := []uint64{}
+	wildcard := false
+	for _, component := range components {
+		if isWildcard(component) {
+			wildcard = true
+			continue
+		}
+		n, err := strconv.ParseUint(component, 10, 64)
+		if err != nil || wildcard {
+			return nil, fmt.Errorf("invalid component %s", component)
+		}
+		parts = append(parts, n)
+	}
+
+	return parts, nil
+}
+
+func isWildcard(component string) bool {
+	return component == "x" || component == "X" || component == "*"
+}
+
+// floor returns the lowest version matching the partial one
+func (pv partialVersion) floor() semver.Version {
+	v := partsVersion(pv.parts)
+	v.Pre = pv.pre
+	return v
+}
+
+// bump returns the version following all the ones sharing the first
+// `n+1` components with the partial one
+func (pv partialVersion) bump(n int) semver.Version {
+	parts := append([]uint64{}, pv.parts[:n+1]...)
+	parts[n]++
+	return partsVersion(parts)
+}
+
+// span returns the range of the versions matching the partial one
+func (pv partialVersion) span() semver.Range {
+	switch {
+	case len(pv.parts) == 0:
+		return anyVersion
+	case pv.complete:
+		return pv.versionEQ(pv.floor())
+	}
+	return pv.versionGTE(pv.floor()).AND(pv.versionLT(pv.bump(len(pv.parts) - 1)))
+}
+
+func (pv partialVersion) comparison(operator string) semver.Range {
+	n := len(pv.parts)
+	switch operator {
+	case "!=", "!":
+		span := pv.span()
+		return func(v semver.Version) bool { return !span(v) }
+	case ">":
+		if n == 0 {
+			return noVersion
+		}
+		if pv.complete {
+			return pv.versionGT(pv.floor())
+		}
+		return pv.versionGTE(pv.bump(n - 1))
+	case ">=":
+		return pv.versionGTE(pv.floor())
+	case "<":
+		if n == 0 {
+			return noVersion
+		}
+		return pv.versionLT(pv.floor())
+	case "<=":
+		if n == 0 {
+			return anyVersion
+		}
+		if pv.complete {
+			return pv.versionLTE(pv.floor())
+		}
+		return pv.versionLT(pv.bump(n - 1))
+	case "~", "~>":
+		if n == 0 {
+			return anyVersion
+		}
+		if n == 1 {
+			return pv.versionGTE(pv.floor()).AND(pv.versionLT(pv.bump(0)))
+		}
+		return pv.versionGTE(pv.floor()).AND(pv.versionLT(pv.bump(1)))
+	case "^":
+		if n == 0 {
+			return anyVersion
+		}
+		// the first non-zero component must not change
+		changing := 0
+		for changing < n-1 && pv.parts[changing] == 0 {
+			changing++
+		}
+		return pv.versionGTE(pv.floor()).AND(pv.versionLT(pv.bump(changing)))
+	}
+
+	return pv.span()
+}
+
+func hyphenRange(lower, upper partialVersion) semver.Range {
+	r := lower.versionGTE(lower.floor())
+	switch {
+	case len(upper.parts) == 0:
+		return r
+	case upper.complete:
+		return r.AND(upper.versionLTE(upper.floor()))
+	}
+	return r.AND(upper.versionLT(upper.bump(len(upper.parts) - 1)))
+}
+
+func anyVersion(v semver.Version) bool {
+	return true
+}
+
+func noVersion(v semver.Version) bool {
+	return false
+}
+
+// versionEQ and the other comparisons follow the order of the scheme
+// of the partial version
+func (pv partialVersion) versionEQ(o semver.Version) semver.Range {
+	return func(v semver.Version) bool { return pv.scheme.Compare(v, o) == 0 }
+}
+
+func (pv partialVersion) versionGT(o semver.Version) semver.Range {
+	return func(v semver.Version) bool { return pv.scheme.Compare(v, o) > 0 }
+}
+
+func (pv partialVersion) versionGTE(o semver.Version) semver.Range {
+	return func(v semver.Version) bool { return pv.scheme.Compare(v, o) >= 0 }
+}
+
+func (pv partialVersion) versionLT(o semver.Version) semver.Range {
+	return func(v semver.Version) bool { return pv.scheme.Compare(v, o) < 0 }
+}
+
+func (pv partialVersion) versionLTE(o semver.Version) semver.Range {
+	return func(v semver.Version) bool { return pv.scheme.Compare(v, o) <= 0 }
+}
@@ -0,0 +1,114 @@
+package fresh_container
+
+import (
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+type ParseConstraintTestCase struct {
+	Constraint string
+	Matching   []string
+	Other      []string
+}
+
+func TestParseConstraint(t *testing.T) {
+	testCases := []ParseConstraintTestCase{
+		ParseConstraintTestCase{
+			Constraint: ">= 1.5.0 < 1.6.0",
+			Matching:   []string{"1.5.0", "1.5.9"},
+			Other:      []string{"1.4.9", "1.6.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "^1.9",
+			Matching:   []string{"1.9.0", "1.10.2", "1.99.0"},
+			Other:      []string{"1.8.9", "2.0.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "^0.2.3",
+			Matching:   []string{"0.2.3", "0.2.9"},
+			Other:      []string{"0.2.2", "0.3.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "^0.0.3",
+			Matching:   []string{"0.0.3"},
+			Other:      []string{"0.0.4"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "~1.9.0",
+			Matching:   []string{"1.9.0", "1.9.7"},
+			Other:      []string{"1.10.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "~> 1",
+			Matching:   []string{"1.0.0", "1.9.7"},
+			Other:      []string{"2.0.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "1.9.x",
+			Matching:   []string{"1.9.0", "1.9.7"},
+			Other:      []string{"1.8.0", "1.10.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "v1.*",
+			Matching:   []string{"1.0.0", "1.9.7"},
+			Other:      []string{"0.9.0", "2.0.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "*",
+			Matching:   []string{"0.0.1", "9.0.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "1.9.0 - 1.10.0",
+			Matching:   []string{"1.9.0", "1.10.0"},
+			Other:      []string{"1.8.9", "1.10.1"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "1.9 - 2",
+			Matching:   []string{"1.9.0", "2.9.9"},
+			Other:      []string{"1.8.9", "3.0.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: ">1.9, <=2.1",
+			Matching:   []string{"1.10.0", "2.1.5"},
+			Other:      []string{"1.9.5", "2.2.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: "(^1.2 || ^3.1) != 3.1.5",
+			Matching:   []string{"1.2.0", "3.1.4", "3.2.0"},
+			Other:      []string{"2.0.0", "3.1.5", "4.0.0"},
+		},
+		ParseConstraintTestCase{
+			Constraint: ">= 1.5.0-alpine < 1.6.0-alpine",
+			Matching:   []string{"1.5.0-alpine", "1.5.6"},
+			Other:      []string{"1.6.0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		r, err := ParseConstraint(tc.Constraint)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		for _, v := range tc.Matching {
+			if !r(semver.MustParse(v)) {
+				t.Errorf("Expected %s to satisfy test case %+v", v, tc)
+			}
+		}
+		for _, v := range tc.Other {
+			if r(semver.MustParse(v)) {
+				t.Errorf("Expected %s not to satisfy test case %+v", v, tc)
+			}
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, constraint := range []string{"", ">=", "^1.x.2", "1.2.3.4", "(^1.2", "^1.2)", "1.2 ||", ">= foo", "1.2-beta"} {
+		if _, err := ParseConstraint(constraint); err == nil {
+			t.Errorf("Expected failure parsing the %q constraint", constraint)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package fresh_container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+)
+
+// NewDigestImage creates an Image that is going to be evaluated
+// using its digest. Contrary to `NewImage`, the tag of the image
+// doesn't have to respect semantic versioning: floating tags like
+// `latest` or `1.21` are allowed.
+// The image must have a tag, that is the reference used to find
+// the digest published by the registry.
+// The default configuration is used when `cfg` is nil.
+func NewDigestImage(image string, cfg *config.Config) (Image, error) {
+	image, locations, err := resolveImage(image, configOrDefault(cfg))
+	if err != nil {
+		return Image{}, err
+	}
+
+	img, err := registry.ParseImage(image)
+	if err != nil {
+		return Image{}, err
+	}
+	if img.Tag == "" {
+		return Image{}, fmt.Errorf("The image %s must be referenced by tag when the digest mode is used", image)
+	}
+
+	return Image{
+		Image:     img,
+		locations: locations,
+	}, nil
+}
+
+// FetchDigest queries the registry that holds the image to find
+// the digest currently associated with the image tag.
+// The digest is stored into the `TagDigest` field.
+func (image *Image) FetchDigest(ctx context.Context, cfg *config.Config) error {
+	return image.withRegistry(ctx, cfg, func(r *registry.Registry, location registries.Location) error {
+		var err error
+		image.TagDigest, err = manifestDigest(ctx, r, location.Path, image.Tag)
+		return err
+	})
+}
+
+// FullNameWithTag returns the name of the image including its tag
+// but without its digest
+func (image *Image) FullNameWithTag() string {
+	return fmt.Sprintf("%s:%s", image.FullNameWithoutTag(), image.Tag)
+}
+
+// SetDigest sets the digest the image is expected to have
+func (image *Image) SetDigest(digest string) error {
+	img, err := registry.ParseImage(fmt.Sprintf("%s@%s", image.FullNameWithTag(), digest))
+	if err != nil {
+		return err
+	}
+
+	image.Image = img
+	return nil
+}
+
+// EvalDigestUpgrade compares the digest of the image with the one
+// the registry currently associates with the image tag.
+// The image is stale when the two digests are different.
+func (image *Image) EvalDigestUpgrade() (ImageUpgradeEvaluationResponse, error) {
+	if image.Digest == "" {
+		return ImageUpgradeEvaluationResponse{},
+			fmt.Errorf("The digest of the %s image is unknown", image.FullNameWithTag())
+	}
+	if image.TagDigest == "" {
+		return ImageUpgradeEvaluationResponse{},
+			fmt.Errorf("The digest of the %s tag has not been fetched", image.FullNameWithTag())
+	}
+
+	return ImageUpgradeEvaluationResponse{
+		Image:          image.FullNameWithoutTag(),
+		CurrentVersion: image.Tag,
+		NextVersion:    image.Tag,
+		CurrentDigest:  image.Digest.String(),
+		NextDigest:     image.TagDigest,
+		Location:       image.locationName(),
+		Stale:          image.Digest.String() != image.TagDigest,
+	}, nil
+}
+
+// DigestLock keeps track of the digests of the images being used.
+// It is stored as a json file that maps the full name of an image,
+// including its tag, to its digest.
+type DigestLock struct {
+	path    string
+	Digests map[string]string
+}
+
+// LoadDigestLock reads the lock file stored at the given path.
+// An empty lock is returned when the file does not exist yet.
+func LoadDigestLock(path string) (DigestLock, error) {
+	lock := DigestLock{
+		path:    path,
+		Digests: make(map[string]string),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return DigestLock{}, err
+	}
+
+	if err = json.Unmarshal(data, &lock.Digests); err != nil {
+		return DigestLock{}, fmt.Errorf("Cannot parse digest lock file %s: %v", path, err)
+	}
+
+	return lock, nil
+}
+
+// Get returns the digest locked for the image, an empty string is
+// returned when the image is not part of the lock
+func (l *DigestLock) Get(image Image) string {
+	return l.Digests[image.FullNameWithTag()]
+}
+
+// Set locks the image to the given digest
+func (l *DigestLock) Set(image Image, digest string) {
+	l.Digests[image.FullNameWithTag()] = digest
+}
+
+// Save writes the lock back to disk
+func (l *DigestLock) Save() error {
+	data, err := json.MarshalIndent(l.Digests, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(l.path, data, 0644)
+}
@@ -0,0 +1,180 @@
+package fresh_container
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+const (
+	oldDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	newDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+type NewDigestImageTestCase struct {
+	Image    string
+	Expected string
+	Invalid  bool
+}
+
+func TestNewDigestImage(t *testing.T) {
+	cfg := config.NewConfig()
+
+	testCases := []NewDigestImageTestCase{
+		NewDigestImageTestCase{Image: "nginx:1.21@" + oldDigest, Expected: "docker.io/library/nginx:1.21"},
+		NewDigestImageTestCase{Image: "nginx:latest", Expected: "docker.io/library/nginx:latest"},
+		NewDigestImageTestCase{Image: "nginx", Expected: "docker.io/library/nginx:latest"},
+		// there's no tag to look up
+		NewDigestImageTestCase{Image: "nginx@" + oldDigest, Invalid: true},
+		NewDigestImageTestCase{Image: "nginx:1.21@sha256:broken", Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		image, err := NewDigestImage(tc.Image, &cfg)
+		if tc.Invalid {
+			if err == nil {
+				t.Errorf("Expected failure for test case %+v, got %+v", tc, image)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if image.FullNameWithTag() != tc.Expected {
+			t.Errorf("Unexpected image for test case %+v, got %s", tc, image.FullNameWithTag())
+		}
+	}
+}
+
+func TestFetchDigest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" || r.URL.Path != "/v2/team/app/manifests/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// manifest lists must be accepted to get the digest of multi-arch images
+		if !strings.Contains(strings.Join(r.Header["Accept"], ","), "manifest.list.v2+json") {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", newDigest)
+	}))
+	defer srv.Close()
+
+	host, rc := newTestRegistryConfig(srv)
+	rc.MaxRetries = -1
+	cfg := config.NewConfig()
+	cfg.Registries = map[string]config.RegistryConfig{host: rc}
+
+	testCases := map[string]bool{
+		oldDigest: true,
+		newDigest: false,
+	}
+	for digest, stale := range testCases {
+		image, err := NewDigestImage(host+"/team/app:latest@"+digest, &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = image.FetchDigest(context.Background(), &cfg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if image.TagDigest != newDigest {
+			t.Errorf("Unexpected tag digest %s", image.TagDigest)
+		}
+
+		evaluation, err := image.EvalDigestUpgrade()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if evaluation.Stale != stale ||
+			evaluation.CurrentDigest != digest ||
+			evaluation.NextDigest != newDigest ||
+			evaluation.CurrentVersion != "latest" {
+			t.Errorf("Unexpected evaluation for digest %s, got %+v", digest, evaluation)
+		}
+	}
+
+	image, err := NewDigestImage(host+"/team/missing:latest", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = image.FetchDigest(context.Background(), &cfg); err == nil {
+		t.Errorf("Expected an error, got digest %s", image.TagDigest)
+	}
+}
+
+func TestEvalDigestUpgradeMissingDigest(t *testing.T) {
+	cfg := config.NewConfig()
+
+	image, err := NewDigestImage("nginx:latest", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image.TagDigest = newDigest
+	if _, err = image.EvalDigestUpgrade(); err == nil {
+		t.Error("Expected an error when the digest of the image is unknown")
+	}
+
+	image, err = NewDigestImage("nginx:latest@"+oldDigest, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = image.EvalDigestUpgrade(); err == nil {
+		t.Error("Expected an error when the digest of the tag has not been fetched")
+	}
+}
+
+func TestDigestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fresh-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "digests.lock")
+
+	cfg := config.NewConfig()
+	image, err := NewDigestImage("nginx:1.21", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a missing lock file is an empty lock
+	lock, err := LoadDigestLock(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lock.Get(image) != "" {
+		t.Errorf("Unexpected digest %s", lock.Get(image))
+	}
+
+	lock.Set(image, oldDigest)
+	if err = lock.Save(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lock, err = LoadDigestLock(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lock.Get(image) != oldDigest {
+		t.Errorf("Unexpected digest %q", lock.Get(image))
+	}
+	if err = image.SetDigest(lock.Get(image)); err != nil || image.Digest.String() != oldDigest {
+		t.Errorf("Cannot set the locked digest: %v", err)
+	}
+
+	if err = ioutil.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadDigestLock(path); err == nil {
+		t.Error("Expected an error when loading a broken lock file")
+	}
+}
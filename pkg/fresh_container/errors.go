@@ -0,0 +1,63 @@
+package fresh_container
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorKind classifies the errors returned by the registries
+type ErrorKind string
+
+const (
+	// The credentials are missing, wrong or not allowed to access the image
+	ErrorKindAuth ErrorKind = "auth"
+	// The image or the tag do not exist
+	ErrorKindNotFound ErrorKind = "not-found"
+	// The rate limit of the registry has been reached
+	ErrorKindRateLimited ErrorKind = "rate-limited"
+	// The registry cannot be reached, timed out or is failing
+	ErrorKindUnreachable ErrorKind = "unreachable"
+	// Any other error returned by the registry
+	ErrorKindUnknown ErrorKind = "unknown"
+)
+
+// RegistryError is returned when a request sent to a registry fails
+type RegistryError struct {
+	Registry string
+	Kind     ErrorKind
+	Err      error
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("%s error from the %s registry: %v", e.Kind, e.Registry, e.Err)
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorKindOf returns the classification of the error, an empty
+// string when it has not been returned by a registry
+func ErrorKindOf(err error) ErrorKind {
+	var registryErr *RegistryError
+	if errors.As(err, &registryErr) {
+		return registryErr.Kind
+	}
+	return ""
+}
+
+func errorKindOfStatus(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorKindAuth
+	case statusCode == http.StatusNotFound:
+		return ErrorKindNotFound
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorKindRateLimited
+	case statusCode >= 500:
+		return ErrorKindUnreachable
+	default:
+		return ErrorKindUnknown
+	}
+}
@@ -0,0 +1,78 @@
+package fresh_container
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// TagExclusions lists the tags that must never be recommended, like
+// withdrawn releases. Each entry is either:
+//
+//   - a regular expression enclosed by slashes, e.g. `/-rc\d+$/`
+//   - a glob pattern, see `path.Match`, e.g. `1.4.*`
+//   - a version, e.g. `1.2.4`, which excludes all the tags parsed into it
+//   - the name of a tag
+//
+// Tags are matched once the prefix has been removed.
+type TagExclusions []tagExclusion
+
+type tagExclusion struct {
+	entry  string
+	regexp *regexp.Regexp
+	glob   bool
+}
+
+// ParseTagExclusions validates the entries, see `TagExclusions`
+func ParseTagExclusions(entries []string) (TagExclusions, error) {
+	exclusions := TagExclusions{}
+	for _, entry := range entries {
+		exclusion := tagExclusion{entry: entry}
+		switch {
+		case entry == "":
+			continue
+		case len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+			re, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid exclusion %s: %v", entry, err)
+			}
+			exclusion.regexp = re
+		case strings.ContainsAny(entry, "*?["):
+			if _, err := path.Match(entry, ""); err != nil {
+				return nil, fmt.Errorf("Invalid exclusion %s: %v", entry, err)
+			}
+			exclusion.glob = true
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+
+	return exclusions, nil
+}
+
+// Excludes returns the entry excluding the tag, whose version has been
+// parsed using the scheme. `ok` is false when the tag is not excluded.
+func (exclusions TagExclusions) Excludes(scheme VersionScheme, tag string, v semver.Version) (entry string, ok bool) {
+	for _, exclusion := range exclusions {
+		if exclusion.matches(scheme, tag, v) {
+			return exclusion.entry, true
+		}
+	}
+	return "", false
+}
+
+func (exclusion tagExclusion) matches(scheme VersionScheme, tag string, v semver.Version) bool {
+	if exclusion.regexp != nil {
+		return exclusion.regexp.MatchString(tag)
+	}
+	if exclusion.glob {
+		matched, _ := path.Match(exclusion.entry, tag)
+		return matched
+	}
+	if excluded, err := scheme.Parse(exclusion.entry); err == nil {
+		return scheme.Compare(excluded, v) == 0
+	}
+	return exclusion.entry == tag
+}
@@ -0,0 +1,93 @@
+package fresh_container
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+type TagExclusionTestCase struct {
+	Entry    string
+	Tag      string
+	Excluded bool
+}
+
+func TestTagExclusions(t *testing.T) {
+	testCases := []TagExclusionTestCase{
+		TagExclusionTestCase{Entry: "1.2.4", Tag: "1.2.4", Excluded: true},
+		TagExclusionTestCase{Entry: "1.2.4", Tag: "v1.2.4", Excluded: true},
+		TagExclusionTestCase{Entry: "1.2.4", Tag: "1.2.4-alpine", Excluded: false},
+		TagExclusionTestCase{Entry: "1.4.*", Tag: "1.4.2-alpine", Excluded: true},
+		TagExclusionTestCase{Entry: "1.4.*", Tag: "1.5.0", Excluded: false},
+		TagExclusionTestCase{Entry: `/-rc\d+$/`, Tag: "1.5.0-rc1", Excluded: true},
+		TagExclusionTestCase{Entry: `/-rc\d+$/`, Tag: "1.5.0-rc1-alpine", Excluded: false},
+		TagExclusionTestCase{Entry: "v1.2", Tag: "v1.2", Excluded: true},
+		TagExclusionTestCase{Entry: "v1.2", Tag: "1.2.0", Excluded: true},
+	}
+
+	scheme := SemverScheme{Loose: true}
+	for _, tc := range testCases {
+		exclusions, err := ParseTagExclusions([]string{tc.Entry})
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		v, err := scheme.Parse(tc.Tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, excluded := exclusions.Excludes(scheme, tc.Tag, v); excluded != tc.Excluded {
+			t.Errorf("Unexpected result for test case %+v", tc)
+		}
+	}
+
+	for _, entry := range []string{"/[/", "1.[2"} {
+		if _, err := ParseTagExclusions([]string{entry}); err == nil {
+			t.Errorf("Expected failure parsing the %s exclusion", entry)
+		}
+	}
+}
+
+func TestEvalUpgradeExclude(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Repositories = map[string]config.RepositoryConfig{
+		"registry.local.lan/team/app": config.RepositoryConfig{Exclude: []string{"1.2.5"}},
+	}
+	request := ImageUpgradeEvaluationRequest{
+		Image:   "registry.local.lan/team/app:1.2.3",
+		Exclude: []string{"1.2.[78]"},
+		Explain: true,
+	}
+	image, err := NewImageFromRequest(request, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := staticTagSource{"1.2.2", "1.2.3", "1.2.4", "1.2.5", "1.2.6", "1.2.7", "1.2.8"}
+	if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	evaluation, err := image.EvalUpgrade(">= 1.2.0 < 1.3.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if evaluation.NextVersion != "1.2.6" {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+	if !reflect.DeepEqual(evaluation.Excluded, []string{"1.2.5", "1.2.7", "1.2.8"}) {
+		t.Errorf("Unexpected excluded tags %+v", evaluation.Excluded)
+	}
+	for _, verdict := range evaluation.Explanation {
+		if verdict.Tag == "1.2.7" && verdict.Reason != "excluded by 1.2.[78]" {
+			t.Errorf("Unexpected verdict %+v", verdict)
+		}
+	}
+	// the intermediate versions do not include the excluded tags
+	if evaluation.Lag == nil || evaluation.Lag.Releases != 2 {
+		t.Errorf("Unexpected lag %+v", evaluation.Lag)
+	}
+}
@@ -0,0 +1,78 @@
+package fresh_container
+
+import (
+	"fmt"
+
+	"github.com/blang/semver"
+)
+
+// TagExplanation tells why a tag has been recommended or not
+type TagExplanation struct {
+	Tag      string `json:"tag"`
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason"`
+}
+
+// explanation collects the verdicts about the tags of an image while
+// they are parsed and compared. The last verdict about a tag wins.
+// A nil explanation ignores them.
+type explanation struct {
+	tags     []string
+	verdicts map[string]TagExplanation
+	// Tags, prefix included, the versions have been parsed from
+	versionTags map[string]string
+}
+
+func newExplanation() *explanation {
+	return &explanation{
+		verdicts:    map[string]TagExplanation{},
+		versionTags: map[string]string{},
+	}
+}
+
+func (e *explanation) record(tag string, accepted bool, format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+
+	if _, found := e.verdicts[tag]; !found {
+		e.tags = append(e.tags, tag)
+	}
+	e.verdicts[tag] = TagExplanation{
+		Tag:      tag,
+		Accepted: accepted,
+		Reason:   fmt.Sprintf(format, args...),
+	}
+}
+
+// recordVersion records the verdict about the tag the version has been
+// parsed from
+func (e *explanation) recordVersion(v semver.Version, accepted bool, format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+
+	if tag, found := e.versionTags[v.String()]; found {
+		e.record(tag, accepted, format, args...)
+	}
+}
+
+func (e *explanation) setVersionTag(v semver.Version, tag string) {
+	if e == nil {
+		return
+	}
+	e.versionTags[v.String()] = tag
+}
+
+// list returns the verdicts in the order the tags have been seen
+func (e *explanation) list() []TagExplanation {
+	if e == nil {
+		return nil
+	}
+
+	verdicts := []TagExplanation{}
+	for _, tag := range e.tags {
+		verdicts = append(verdicts, e.verdicts[tag])
+	}
+	return verdicts
+}
@@ -0,0 +1,126 @@
+package fresh_container
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/pkg/registrytest"
+)
+
+func TestEvalUpgradeExplain(t *testing.T) {
+	cfg := config.NewConfig()
+	request := ImageUpgradeEvaluationRequest{Image: "registry.local.lan/team/app:app-1.2.0", TagPrefix: "app-", Loose: true, Explain: true}
+	image, err := NewImageFromRequest(request, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := staticTagSource{
+		"app-1.1.0",
+		"app-1.2.0",
+		"app-1.2.3",
+		"app-v1.2.3",
+		"app-1.2.5",
+		"app-1.2.5-alpine",
+		"app-2.0.0",
+		"app-latest",
+		"latest",
+	}
+	if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	evaluation, err := image.EvalUpgrade("< 2.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"app-1.1.0":        "older than the current version",
+		"app-1.2.0":        "current version",
+		"app-1.2.3":        "newer, but not picked by the latest strategy",
+		"app-v1.2.3":       "same version as the app-1.2.3 tag",
+		"app-1.2.5":        "recommended",
+		"app-1.2.5-alpine": `flavor family "alpine" differs from the "" one of the current tag`,
+		"app-2.0.0":        "does not satisfy the constraint",
+		"app-latest":       "invalid version",
+		"latest":           "does not start with the tag prefix app-",
+	}
+	if len(evaluation.Explanation) != len(expected) {
+		t.Fatalf("Unexpected explanation %+v", evaluation.Explanation)
+	}
+	for _, verdict := range evaluation.Explanation {
+		if !strings.HasPrefix(verdict.Reason, expected[verdict.Tag]) {
+			t.Errorf("Unexpected verdict %+v, expected %s", verdict, expected[verdict.Tag])
+		}
+		accepted := verdict.Tag == "app-1.2.0" || verdict.Tag == "app-1.2.5"
+		if verdict.Accepted != accepted {
+			t.Errorf("Unexpected verdict %+v", verdict)
+		}
+	}
+
+	// nothing is recorded unless asked for
+	request.Explain = false
+	image, err = NewImageFromRequest(request, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	evaluation, err = image.EvalUpgrade("< 2.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if evaluation.Explanation != nil {
+		t.Errorf("Unexpected explanation %+v", evaluation.Explanation)
+	}
+}
+
+func TestEvaluateExplainHeldBack(t *testing.T) {
+	now := time.Now()
+
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.AddImage("team/app", "1.0.0", registrytest.Image{Created: now.Add(-400 * 24 * time.Hour)})
+	reg.AddImage("team/app", "1.1.0", registrytest.Image{Created: now.Add(-30 * 24 * time.Hour)})
+	reg.AddImage("team/app", "1.2.0", registrytest.Image{Created: now.Add(-time.Hour)})
+
+	cfg := reg.Config()
+
+	request := ImageUpgradeEvaluationRequest{
+		Image:         reg.Host() + "/team/app:1.0.0",
+		Constraint:    "< 2.0.0",
+		MinReleaseAge: "7d",
+		Explain:       true,
+	}
+	image, err := NewImageFromRequest(request, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = image.FetchTags(context.Background(), cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	evaluation, err := image.Evaluate(context.Background(), cfg, request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"1.0.0": "current version",
+		"1.1.0": "recommended",
+		"1.2.0": "built on",
+	}
+	if len(evaluation.Explanation) != len(expected) {
+		t.Fatalf("Unexpected explanation %+v", evaluation.Explanation)
+	}
+	for _, verdict := range evaluation.Explanation {
+		if !strings.HasPrefix(verdict.Reason, expected[verdict.Tag]) {
+			t.Errorf("Unexpected verdict %+v, expected %s", verdict, expected[verdict.Tag])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package fresh_container
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+var flavorVersionRegexp = regexp.MustCompile(`\d+(?:\.\d+)*`)
+
+// Flavor is the variant of an image carried by the pre-release part of
+// its tag. The flavor can have its own version: the `alpine3.16` flavor
+// of `14.5-alpine3.16` belongs to the `alpine` family and has the `3.16`
+// version.
+type Flavor struct {
+	Name    string
+	Family  string
+	Version string
+}
+
+// ParseFlavor returns the flavor of the version, the first group of
+// numbers separated by dots found inside of its pre-release is the
+// version of the flavor
+func ParseFlavor(v semver.Version) Flavor {
+	name := strings.TrimPrefix(formatPre(v), "-")
+
+	flavor := Flavor{Name: name, Family: name}
+	if loc := flavorVersionRegexp.FindStringIndex(name); loc != nil {
+		flavor.Family = name[:loc[0]] + name[loc[1]:]
+		flavor.Version = name[loc[0]:loc[1]]
+	}
+
+	return flavor
+}
+
+// compareVersion compares the versions of the flavors, component by
+// component. A flavor without version is lower than the others.
+func (f Flavor) compareVersion(other Flavor) int {
+	p1, p2 := flavorParts(f.Version), flavorParts(other.Version)
+	for i := 0; i < len(p1) || i < len(p2); i++ {
+		var n1, n2 uint64
+		if i < len(p1) {
+			n1 = p1[i]
+		}
+		if i < len(p2) {
+			n2 = p2[i]
+		}
+		if n1 != n2 {
+			if n1 < n2 {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func flavorParts(version string) []uint64 {
+	parts := []uint64{}
+	if version == "" {
+		return parts
+	}
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.ParseUint(part, 10, 64)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// compareFlavored compares the versions without their flavors first,
+// then the versions of the flavors. The flavors must belong to the
+// same family.
+func compareFlavored(scheme VersionScheme, v1, v2 semver.Version) int {
+	if c := scheme.Compare(withoutPre(v1), withoutPre(v2)); c != 0 {
+		return c
+	}
+	return ParseFlavor(v1).compareVersion(ParseFlavor(v2))
+}
+
+func withoutPre(v semver.Version) semver.Version {
+	v.Pre = nil
+	return v
+}
@@ -0,0 +1,29 @@
+package fresh_container
+
+import (
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+type ParseFlavorTestCase struct {
+	Version  string
+	Expected Flavor
+}
+
+func TestParseFlavor(t *testing.T) {
+	testCases := []ParseFlavorTestCase{
+		ParseFlavorTestCase{Version: "1.2.3", Expected: Flavor{}},
+		ParseFlavorTestCase{Version: "1.2.3-alpine", Expected: Flavor{Name: "alpine", Family: "alpine"}},
+		ParseFlavorTestCase{Version: "14.5.0-alpine3.16", Expected: Flavor{Name: "alpine3.16", Family: "alpine", Version: "3.16"}},
+		ParseFlavorTestCase{Version: "1.2.3-jdk17-slim", Expected: Flavor{Name: "jdk17-slim", Family: "jdk-slim", Version: "17"}},
+		ParseFlavorTestCase{Version: "1.2.3-rc.1", Expected: Flavor{Name: "rc.1", Family: "rc.", Version: "1"}},
+	}
+
+	for _, tc := range testCases {
+		flavor := ParseFlavor(semver.MustParse(tc.Version))
+		if flavor != tc.Expected {
+			t.Errorf("Unexpected flavor for test case %+v, got %+v", tc, flavor)
+		}
+	}
+}
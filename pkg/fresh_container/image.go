@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
 	"github.com/genuinetools/reg/registry"
-	"github.com/genuinetools/reg/repoutils"
+	log "github.com/sirupsen/logrus"
 )
 
 // Image is an extended struct that represents
@@ -19,54 +21,256 @@ type Image struct {
 	TagVersion  semver.Version
 	TagVersions semver.Versions
 	TagPrefix   string
+	// Tags like `v1.2` are coerced into versions, see `ParseTag`
+	Loose bool
+	// Scheme the tags are parsed with, semver when not set
+	Scheme VersionScheme
+	// Extracts the version out of the tags, once the prefix is removed
+	TagPattern *TagPattern
+	// Variant captured by the pattern out of the current tag
+	Variant string
+	// Picks the recommended version, see `UpgradeStrategy`
+	Strategy UpgradeStrategy
+	// Tags that are never recommended
+	Exclude TagExclusions
+	// Digest the registry currently associates with the image tag
+	TagDigest string
+	// Set when the tags are read from the local filesystem
+	// instead of the registry
+	local *localSource
+	// Places the image can be fetched from, as defined by the
+	// registries.conf file. Mirrors come first.
+	locations []registries.Location
+	// The location that answered the last registry query
+	location *registries.Location
+	// Tags the versions have been parsed from, without the prefix,
+	// indexed by version
+	tagNames map[string]string
+	// Tags as returned by the tag source
+	rawTags []string
+	// Records the verdicts about the tags when the evaluation has
+	// to be explained
+	explanation *explanation
+}
+
+// ImageUpgradeEvaluationRequest holds the parameters of
+// an upgrade evaluation
+type ImageUpgradeEvaluationRequest struct {
+	Image      string
+	Constraint string
+	// Derives the constraint from the current version, instead of
+	// using `Constraint`, see `UpdatePolicy`
+	Policy    string
+	TagPrefix string
+	// Regular expression extracting the version out of the tags, see
+	// `TagPattern`
+	TagPattern string
+	// Compare the digest of the image with the one of the remote tag
+	// instead of looking for newer tags
+	Digest bool
+	// Only consider tags publishing an image for this platform,
+	// expressed as `os/arch[/variant]`
+	Platform string
+	// Images built longer than this ago are stale, even when no newer
+	// tag exists. Expressed like `90d`, see `ParseAge`
+	MaxAge string
+	// Tags built more recently than this are not recommended,
+	// expressed like `72h`, see `ParseAge`
+	MinReleaseAge string
+	// Coerce tags like `v1.2.3`, `1.21` or `3` into versions
+	Loose bool
+	// Version scheme followed by the tags, see `VersionSchemes`.
+	// The one set inside of the configuration for the repository
+	// is used when empty, semver otherwise.
+	Scheme string
+	// Picks the recommended version among the ones satisfying the
+	// constraint, see `UpgradeStrategies`. The latest one when empty.
+	Strategy string
+	// Report why each tag has been recommended or not
+	Explain bool
+	// Tags that must never be recommended, see `TagExclusions`. They
+	// are added to the ones set inside of the configuration for the
+	// repository.
+	Exclude []string
 }
 
 type ImageUpgradeEvaluationResponse struct {
 	Image          string `json:"image"`
 	Constraint     string `json:"constraint"`
 	TagPrefix      string `json:"tagPrefix"`
+	TagPattern     string `json:"tagPattern,omitempty"`
+	Strategy       string `json:"strategy,omitempty"`
 	CurrentVersion string `json:"current_version"`
 	NextVersion    string `json:"next_version"`
-	Stale          bool   `json:"stale"`
+	// Highest versions available regardless of the constraint,
+	// see `FindLatestVersions`
+	LatestPatch   string `json:"latest_patch,omitempty"`
+	LatestMinor   string `json:"latest_minor,omitempty"`
+	LatestMajor   string `json:"latest_major,omitempty"`
+	LatestOverall string `json:"latest_overall,omitempty"`
+	// How far the current version is behind the next one, omitted
+	// when there is no newer version
+	Lag *VersionLag `json:"lag,omitempty"`
+	// Excluded tags newer than the current one
+	Excluded       []string         `json:"excluded,omitempty"`
+	CurrentDigest  string           `json:"current_digest,omitempty"`
+	NextDigest     string           `json:"next_digest,omitempty"`
+	Platform       string           `json:"platform,omitempty"`
+	Platforms      []string         `json:"platforms,omitempty"`
+	Location       string           `json:"location,omitempty"`
+	CurrentFlavor  string           `json:"current_flavor,omitempty"`
+	NextFlavor     string           `json:"next_flavor,omitempty"`
+	CurrentCreated *time.Time       `json:"current_created,omitempty"`
+	NextCreated    *time.Time       `json:"next_created,omitempty"`
+	MaxAgeExceeded bool             `json:"max_age_exceeded,omitempty"`
+	HeldBack       []HeldBackTag    `json:"held_back,omitempty"`
+	Explanation    []TagExplanation `json:"explanation,omitempty"`
+	Stale          bool             `json:"stale"`
 }
 
+// NewImage creates an Image out of its reference. Besides the usual
+// registry references, images stored on the local filesystem can be
+// referenced using the `oci:<path>:<name>:<tag>` and
+// `docker-archive:<path>:<name>:<tag>` schemes.
+// The default configuration is used, see `NewImageFromRequest` to
+// provide a different one.
 func NewImage(image, tagPrefix string) (Image, error) {
+	return NewImageFromRequest(ImageUpgradeEvaluationRequest{Image: image, TagPrefix: tagPrefix}, nil)
+}
+
+// NewImageFromRequest behaves like `NewImage`, the reference, the tag
+// prefix, the tag pattern and the version scheme are taken from the
+// request. Tags are coerced into versions when either the request or
+// the configuration ask for it.
+// Short names, mirrors and blocked registries are handled according
+// to the registries.conf file referenced by the configuration. The
+// default configuration is used when `cfg` is nil.
+func NewImageFromRequest(request ImageUpgradeEvaluationRequest, cfg *config.Config) (Image, error) {
+	cfg = configOrDefault(cfg)
+	image := request.Image
+
+	var local *localSource
+	var locations []registries.Location
+	var err error
+	if IsLocalReference(image) {
+		source, ref, err := parseLocalReference(image)
+		if err != nil {
+			return Image{}, err
+		}
+		local = &source
+		image = ref
+	} else {
+		image, locations, err = resolveImage(image, cfg)
+		if err != nil {
+			return Image{}, err
+		}
+	}
+
 	img, err := registry.ParseImage(image)
 
 	if err != nil {
 		return Image{}, err
 	}
 
-	curTag := img.Tag
-	trimmedTag := strings.TrimPrefix(curTag, tagPrefix)
+	scheme, err := resolveScheme(cfg, request.Scheme, request.Loose, img.Domain, img.Path)
+	if err != nil {
+		return Image{}, err
+	}
+
+	result := Image{
+		Image:     img,
+		TagPrefix: request.TagPrefix,
+		Loose:     request.Loose || cfg.LooseVersions,
+		Scheme:    scheme,
+		local:     local,
+		locations: locations,
+	}
+	if request.Explain {
+		result.explanation = newExplanation()
+	}
+	exclude := append(append([]string{}, cfg.GetExclude(img.Domain, img.Path)...), request.Exclude...)
+	if result.Exclude, err = ParseTagExclusions(exclude); err != nil {
+		return Image{}, err
+	}
+	if result.Strategy, err = ParseUpgradeStrategy(request.Strategy); err != nil {
+		return Image{}, err
+	}
+	if request.TagPattern != "" {
+		if result.TagPattern, err = ParseTagPattern(request.TagPattern); err != nil {
+			return Image{}, err
+		}
+	}
 
-	version, err := semver.Parse(trimmedTag)
+	version, variant, ok, err := result.tagMatcher().parse(img.Tag)
 	if err != nil {
 		return Image{}, err
 	}
+	if !ok {
+		return Image{}, fmt.Errorf("The %s tag does not match the tag prefix %s and the tag pattern %s", img.Tag, request.TagPrefix, request.TagPattern)
+	}
+	result.TagVersion = version
+	result.Variant = variant
+
+	return result, nil
+}
+
+// configOrDefault returns the given configuration, or the default
+// one when it is nil
+func configOrDefault(cfg *config.Config) *config.Config {
+	if cfg == nil {
+		defaults := config.NewConfig()
+		return &defaults
+	}
+	return cfg
+}
+
+// resolveImage expands the name of the image using the registries.conf
+// file. It returns the fully qualified reference of the image together
+// with the locations its tags can be fetched from.
+func resolveImage(image string, cfg *config.Config) (string, []registries.Location, error) {
+	name, suffix := splitReference(image)
+
+	qualified, locations, err := cfg.RegistriesConf().Resolve(name)
+	if err != nil {
+		return "", []registries.Location{}, err
+	}
 
-	return Image{
-		TagVersion: version,
-		Image:      img,
-		TagPrefix:  tagPrefix,
-	}, nil
+	return qualified + suffix, locations, nil
+}
+
+// splitReference splits an image reference into its name and
+// the `:tag` and `@digest` parts that follow it
+func splitReference(image string) (string, string) {
+	name := image
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		name = name[:colon]
+	}
+
+	return name, image[len(name):]
 }
 
 // FetchTags queries the registry that holds the image to
-// assess the tags it has.
-// The tags are automatically converted to semver.Version objects
-// and stored into the `TagVersions` field.
+// assess the tags it has, see `RegistryTagSource`.
+// Images stored on the local filesystem get their tags from there.
+// The tags are automatically converted to versions, using the scheme
+// of the image, and stored into the `TagVersions` field.
 // Note well: invalid tags are going to be ignored.
 func (image *Image) FetchTags(ctx context.Context, cfg *config.Config) error {
-	var err error
-
-	// Create the registry client.
-	r, err := createRegistryClient(ctx, image.Domain, cfg)
-	if err != nil {
-		return err
+	var source TagSource = &RegistryTagSource{Config: cfg}
+	if image.local != nil {
+		source = image.local
 	}
 
-	tags, err := r.Tags(ctx, image.Path)
+	return image.FetchTagsFrom(ctx, source)
+}
+
+// FetchTagsFrom behaves like `FetchTags`, but the tags are provided
+// by the given source
+func (image *Image) FetchTagsFrom(ctx context.Context, source TagSource) error {
+	tags, err := source.Tags(ctx, image)
 	if err != nil {
 		return err
 	}
@@ -76,58 +280,390 @@ func (image *Image) FetchTags(ctx context.Context, cfg *config.Config) error {
 }
 
 func (image *Image) SetTagVersions(tags []string, skipInvalid bool) error {
-	var err error
+	if image.explanation != nil {
+		image.explanation = newExplanation()
+	}
+	versions, names, err := tagsToVersions(tags, image.tagMatcher(), skipInvalid, image.explanation)
+	if err != nil {
+		return err
+	}
 
-	image.TagVersions, err = TagsToVersions(tags, image.TagPrefix, skipInvalid)
-	return err
+	image.TagVersions = versions
+	image.tagNames = names
+	image.rawTags = tags
+	return nil
+}
+
+// TagNames returns the tags given to `SetTagVersions`, prefix included.
+// Contrary to `TagVersions` they can be parsed again using other options.
+func (image *Image) TagNames() []string {
+	return image.rawTags
 }
 
 func (image *Image) FullNameWithoutTag() string {
+	if image.local != nil {
+		return image.local.String()
+	}
 	return fmt.Sprintf("%s/%s", image.Domain, image.Path)
 }
 
+// IsLocal returns true when the image is stored on the local filesystem
+func (image *Image) IsLocal() bool {
+	return image.local != nil
+}
+
+// withRegistry runs the query against the locations of the image, one
+// after the other, until one of them succeeds. Once a location answered,
+// the following queries are sent only to it, this ensures the tags and
+// the manifests of the image come from the same place.
+func (image *Image) withRegistry(ctx context.Context, cfg *config.Config, query func(r *registry.Registry, location registries.Location) error) error {
+	cfg = configOrDefault(cfg)
+	if image.local != nil {
+		return fmt.Errorf("The %s image is stored on the local filesystem, its registry cannot be queried", image.FullNameWithoutTag())
+	}
+
+	locations := image.locations
+	if image.location != nil {
+		locations = []registries.Location{*image.location}
+	} else if len(locations) == 0 {
+		locations = []registries.Location{
+			registries.Location{Domain: image.Domain, Path: image.Path},
+		}
+	}
+
+	var err error
+	for i, location := range locations {
+		var r *registry.Registry
+		r, err = createRegistryClient(ctx, location, cfg)
+		if err == nil {
+			err = query(r, location)
+		}
+		if err == nil {
+			image.location = &locations[i]
+			return nil
+		}
+
+		log.WithFields(log.Fields{
+			"image":    image.FullNameWithoutTag(),
+			"location": location.String(),
+		}).WithError(err).Debug("Cannot query image location")
+	}
+
+	return err
+}
+
 func (image *Image) EvalUpgrade(constraint string) (ImageUpgradeEvaluationResponse, error) {
-	constraintRange, err := semver.ParseRange(constraint)
+	constraintRange, err := image.ParseConstraint(constraint)
 	if err != nil {
 		return ImageUpgradeEvaluationResponse{}, err
 	}
 
-	nextVer := NextVersion(
+	nextVer := nextVersion(
+		image.versionScheme(),
 		image.TagVersion,
 		constraintRange,
-		image.TagPrefix,
 		image.TagVersions,
+		image.Strategy,
+		image.explanation,
 	)
 
-	return ImageUpgradeEvaluationResponse{
+	return image.evaluation(constraint, nextVer), nil
+}
+
+// Evaluate performs the upgrade evaluation described by the request.
+// The tags of the image must have been fetched beforehand, the registry
+// is queried again only when the request requires to inspect the
+// manifests of the tags.
+func (image *Image) Evaluate(ctx context.Context, cfg *config.Config, request ImageUpgradeEvaluationRequest) (ImageUpgradeEvaluationResponse, error) {
+	constraint, err := image.RequestConstraint(request)
+	if err != nil {
+		return ImageUpgradeEvaluationResponse{}, err
+	}
+	constraintRange, err := image.ParseConstraint(constraint)
+	if err != nil {
+		return ImageUpgradeEvaluationResponse{}, err
+	}
+
+	filters := []candidateFilter{}
+
+	var platform *Platform
+	platforms := []Platform{}
+	if request.Platform != "" {
+		p, err := ParsePlatform(request.Platform)
+		if err != nil {
+			return ImageUpgradeEvaluationResponse{}, err
+		}
+		platform = &p
+		filters = append(filters, image.platformFilter(ctx, p, &platforms))
+	}
+
+	heldBack := []HeldBackTag{}
+	if minReleaseAge := image.MinReleaseAge(cfg, request); minReleaseAge != "" {
+		minAge, err := ParseAge(minReleaseAge)
+		if err != nil {
+			return ImageUpgradeEvaluationResponse{}, err
+		}
+		filters = append(filters, image.releaseAgeFilter(ctx, minAge, platform, time.Now(), &heldBack))
+	}
+
+	nextVer, err := image.nextFilteredVersion(ctx, cfg, constraintRange, filters...)
+	if err != nil {
+		return ImageUpgradeEvaluationResponse{}, err
+	}
+
+	evaluation := image.evaluation(constraint, nextVer)
+	if platform != nil {
+		evaluation.Platform = platform.String()
+		evaluation.Platforms = platformNames(platforms)
+	}
+	if len(heldBack) > 0 {
+		evaluation.HeldBack = heldBack
+	}
+
+	if request.MaxAge != "" {
+		maxAge, err := ParseAge(request.MaxAge)
+		if err != nil {
+			return ImageUpgradeEvaluationResponse{}, err
+		}
+		if err = image.EvalAge(ctx, cfg, &evaluation, maxAge, platform); err != nil {
+			return ImageUpgradeEvaluationResponse{}, err
+		}
+	}
+
+	return evaluation, nil
+}
+
+// NeedsRegistry returns true when the evaluation cannot be performed
+// using only the list of tags of the image. Note well: the minimum
+// release age can also be set inside of the configuration, see
+// `Image.MinReleaseAge`.
+func (request *ImageUpgradeEvaluationRequest) NeedsRegistry() bool {
+	return request.Digest || request.Platform != "" || request.MaxAge != "" || request.MinReleaseAge != ""
+}
+
+// Validate checks the options of the request, and how they are combined,
+// before any image is looked up. The command line and the server mode
+// share it, the messages name the options the same way for both.
+func (request *ImageUpgradeEvaluationRequest) Validate() error {
+	if !request.Digest && request.Constraint == "" && request.Policy == "" {
+		return fmt.Errorf("The constraint is required unless the digest mode or a policy is used")
+	}
+	if request.Constraint != "" && request.Policy != "" {
+		return fmt.Errorf("The constraint and the policy cannot be used together")
+	}
+	if request.Digest {
+		for _, option := range []struct {
+			name string
+			set  bool
+		}{
+			{"policy", request.Policy != ""},
+			{"strategy", request.Strategy != ""},
+			{"explain", request.Explain},
+			{"exclude", len(request.Exclude) > 0},
+			{"platform", request.Platform != ""},
+			{"max age", request.MaxAge != ""},
+			{"min release age", request.MinReleaseAge != ""},
+		} {
+			if option.set {
+				return fmt.Errorf("The %s option cannot be used together with the digest mode", option.name)
+			}
+		}
+	}
+	if IsLocalReference(request.Image) && request.NeedsRegistry() {
+		return fmt.Errorf("The digest, platform, max age and min release age options cannot be used with images stored on the local filesystem")
+	}
+
+	if _, err := ParseTagExclusions(request.Exclude); err != nil {
+		return err
+	}
+	if _, err := ParseUpgradeStrategy(request.Strategy); err != nil {
+		return err
+	}
+	if request.Policy != "" {
+		if _, err := ParseUpdatePolicy(request.Policy); err != nil {
+			return err
+		}
+	}
+	for _, age := range []string{request.MaxAge, request.MinReleaseAge} {
+		if age == "" {
+			continue
+		}
+		if _, err := ParseAge(age); err != nil {
+			return err
+		}
+	}
+	if request.Platform != "" {
+		if _, err := ParsePlatform(request.Platform); err != nil {
+			return err
+		}
+	}
+	if request.Scheme != "" {
+		if _, err := NewVersionScheme(request.Scheme, request.Loose); err != nil {
+			return err
+		}
+	}
+	if request.TagPattern != "" {
+		if _, err := ParseTagPattern(request.TagPattern); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (image *Image) evaluation(constraint string, nextVer semver.Version) ImageUpgradeEvaluationResponse {
+	latest := FindLatestVersions(image.versionScheme(), image.TagVersion, image.TagVersions)
+	evaluation := ImageUpgradeEvaluationResponse{
 		Image:          image.FullNameWithoutTag(),
 		Constraint:     constraint,
 		TagPrefix:      image.TagPrefix,
-		Stale:          nextVer.GT(image.TagVersion),
+		TagPattern:     image.tagPatternName(),
+		Strategy:       image.strategyName(),
+		Stale:          image.compareVersions(nextVer, image.TagVersion) > 0,
 		CurrentVersion: image.Tag,
-		NextVersion:    nextVer.String(),
-	}, nil
+		NextVersion:    image.evaluatedName(nextVer),
+		LatestPatch:    image.evaluatedName(latest.Patch),
+		LatestMinor:    image.evaluatedName(latest.Minor),
+		LatestMajor:    image.evaluatedName(latest.Major),
+		LatestOverall:  image.evaluatedName(latest.Overall),
+		Location:       image.locationName(),
+		Lag:            image.lag(nextVer),
+		Excluded:       image.excludedTags(),
+		Explanation:    image.explanation.list(),
+	}
+
+	// the flavor of the image changes together with its version
+	current, next := ParseFlavor(image.TagVersion), ParseFlavor(nextVer)
+	if evaluation.Stale && current.Name != next.Name {
+		evaluation.CurrentFlavor = current.Name
+		evaluation.NextFlavor = next.Name
+	}
+
+	return evaluation
 }
 
-func createRegistryClient(ctx context.Context, domain string, config *config.Config) (*registry.Registry, error) {
-	// Use the auth-url domain if provided.
-	rc := config.GetRegistryConfig(domain)
+// locationName returns the location the image has been fetched from
+// when it differs from the image itself, an empty string otherwise
+func (image *Image) locationName() string {
+	if image.location == nil {
+		return ""
+	}
 
-	auth, err := repoutils.GetAuthConfig(rc.Username, rc.Password, rc.AuthDomain)
-	if err != nil {
-		return nil, err
+	name := image.location.String()
+	if name == image.FullNameWithoutTag() {
+		return ""
+	}
+	return name
+}
+
+// tagName returns the name of the tag matching the given version
+func (image *Image) tagName(version semver.Version) string {
+	return image.TagPrefix + image.versionName(version)
+}
+
+// versionName returns the name, without the prefix, of the tag the
+// version has been parsed from. They differ only in loose mode.
+func (image *Image) versionName(version semver.Version) string {
+	if name, found := image.tagNames[version.String()]; found {
+		return name
 	}
+	return image.versionScheme().Format(version)
+}
 
-	// Prevent non-ssl unless explicitly forced
-	if !rc.NonSSL && strings.HasPrefix(auth.ServerAddress, "http:") {
-		return nil, fmt.Errorf("attempted to use insecure protocol! Use force-non-ssl option to force")
+// evaluatedName returns the name, without the prefix, of the tag of the
+// version. The current tag is reported as it is, even when another tag
+// is coerced into the same version.
+func (image *Image) evaluatedName(version semver.Version) string {
+	if image.compareVersions(version, image.TagVersion) == 0 {
+		return strings.TrimPrefix(image.Tag, image.TagPrefix)
 	}
+	return image.versionName(version)
+}
+
+// compareVersions orders the versions of the tags like `NextVersion`
+func (image *Image) compareVersions(v1, v2 semver.Version) int {
+	return compareFlavored(image.versionScheme(), v1, v2)
+}
 
-	// Create the registry client.
-	return registry.New(ctx, auth, registry.Opt{
-		Domain:   domain,
-		Insecure: rc.Insecure,
-		SkipPing: rc.SkipPing,
-		NonSSL:   rc.NonSSL,
+// tagMatcher returns the matcher selecting the tags that can replace
+// the current one
+func (image *Image) tagMatcher() tagMatcher {
+	return tagMatcher{
+		prefix:  image.TagPrefix,
+		pattern: image.TagPattern,
+		variant: image.Variant,
+		scheme:  image.versionScheme(),
+		exclude: image.Exclude,
+	}
+}
+
+// excludedTags returns the names, without the prefix, of the excluded
+// tags holding a version newer than the current one. Like `NextVersion`,
+// only the versions whose flavor belongs to the family of the current
+// one are considered.
+func (image *Image) excludedTags() []string {
+	if len(image.Exclude) == 0 {
+		return nil
+	}
+
+	type excludedTag struct {
+		version semver.Version
+		name    string
+	}
+
+	matcher := image.tagMatcher()
+	family := ParseFlavor(image.TagVersion).Family
+	tags := []excludedTag{}
+	for _, tag := range image.rawTags {
+		v, variant, ok, err := matcher.parse(tag)
+		if !ok || err != nil || variant != matcher.variant {
+			continue
+		}
+		name := strings.TrimPrefix(tag, image.TagPrefix)
+		if _, excluded := matcher.exclude.Excludes(matcher.scheme, name, v); !excluded {
+			continue
+		}
+		if ParseFlavor(v).Family == family && image.compareVersions(v, image.TagVersion) > 0 {
+			tags = append(tags, excludedTag{version: v, name: name})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return image.compareVersions(tags[i].version, tags[j].version) < 0
 	})
+
+	excluded := []string{}
+	for _, tag := range tags {
+		excluded = append(excluded, tag.name)
+	}
+	return excluded
+}
+
+// strategyName returns the name of the upgrade strategy, an empty
+// string for the default one
+func (image *Image) strategyName() string {
+	if image.Strategy == StrategyLatest {
+		return ""
+	}
+	return string(image.Strategy)
+}
+
+func (image *Image) tagPatternName() string {
+	if image.TagPattern == nil {
+		return ""
+	}
+	return image.TagPattern.String()
+}
+
+// versionScheme returns the scheme the tags are parsed with
+func (image *Image) versionScheme() VersionScheme {
+	if image.Scheme == nil {
+		return SemverScheme{Loose: image.Loose}
+	}
+	return image.Scheme
+}
+
+// ParseConstraint parses the constraint according to the version
+// scheme of the image
+func (image *Image) ParseConstraint(constraint string) (semver.Range, error) {
+	return image.versionScheme().ParseConstraint(constraint)
 }
@@ -0,0 +1,328 @@
+package fresh_container
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/pkg/registrytest"
+)
+
+type staticTagSource []string
+
+func (s staticTagSource) Tags(ctx context.Context, image *Image) ([]string, error) {
+	return s, nil
+}
+
+func TestFetchTagsFrom(t *testing.T) {
+	image, err := NewImage("registry.local.lan/team/app:1.0.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = image.FetchTagsFrom(context.Background(), staticTagSource{"1.1.0", "latest", "1.0.0"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	evaluation, err := image.EvalUpgrade(">= 1.0.0 < 2.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !evaluation.Stale || evaluation.NextVersion != "1.1.0" {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+}
+
+func TestNewImageDefaultConfig(t *testing.T) {
+	image, err := NewImage("nginx:1.21.0", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if image.FullNameWithTag() != "docker.io/library/nginx:1.21.0" {
+		t.Errorf("Unexpected image %s", image.FullNameWithTag())
+	}
+
+	// a nil configuration means the default one
+	if _, err = NewImageFromRequest(ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Exclude: []string{"1.22.0"}}, nil); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err = NewDigestImage("nginx:latest", nil); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if age := image.MinReleaseAge(nil, ImageUpgradeEvaluationRequest{}); age != "" {
+		t.Errorf("Unexpected minimum release age %s", age)
+	}
+}
+
+func TestFetchTagsFromLoose(t *testing.T) {
+	cfg := config.NewConfig()
+	request := ImageUpgradeEvaluationRequest{Image: "registry.local.lan/team/app:v1.2", Loose: true}
+	image, err := NewImageFromRequest(request, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := staticTagSource{"v1.2", "1.2.0", "v1.2.5", "1.3", "v2", "latest"}
+	if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := map[string]string{
+		// the name of the tag is reported, not the coerced version
+		">= 1.2.0 < 2.0.0": "1.3",
+		"< 1.3.0":          "v1.2.5",
+		// the current tag is kept, even if `1.2.0` is the same version
+		"< 1.2.1": "v1.2",
+	}
+	for constraint, expected := range testCases {
+		evaluation, err := image.EvalUpgrade(constraint)
+		if err != nil {
+			t.Errorf("Unexpected error when handling constraint %s: %+v", constraint, err)
+			continue
+		}
+		if evaluation.NextVersion != expected {
+			t.Errorf("Unexpected evaluation for constraint %s, got %+v", constraint, evaluation)
+		}
+		// the latest versions do not depend on the constraint
+		if evaluation.LatestPatch != "v1.2.5" ||
+			evaluation.LatestMinor != "1.3" ||
+			evaluation.LatestMajor != "v2" ||
+			evaluation.LatestOverall != "v2" {
+			t.Errorf("Unexpected latest versions for constraint %s, got %+v", constraint, evaluation)
+		}
+	}
+
+	// strict parsing rejects the current tag
+	request.Loose = false
+	if _, err = NewImageFromRequest(request, &cfg); err == nil {
+		t.Error("Expected failure parsing the v1.2 tag")
+	}
+	cfg.LooseVersions = true
+	if _, err = NewImageFromRequest(request, &cfg); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFetchTagsFromPattern(t *testing.T) {
+	cfg := config.NewConfig()
+	image, err := NewImageFromRequest(ImageUpgradeEvaluationRequest{
+		Image:      "registry.local.lan/team/app:1.5.6-alpine3.18",
+		TagPattern: `(?P<major>\d+)\.(?P<minor>\d+)\.(?P<patch>\d+)-(?P<variant>alpine[\d.]+)`,
+	}, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := staticTagSource{"1.5.6-alpine3.18", "1.5.7-alpine3.18", "1.5.9-alpine3.19", "1.5.8", "1.6.0-alpine3.18", "latest"}
+	if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// only the tags of the same variant are considered
+	evaluation, err := image.EvalUpgrade(">= 1.5.0 < 1.6.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !evaluation.Stale || evaluation.NextVersion != "1.5.7-alpine3.18" {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+
+	// the current tag must match the pattern
+	_, err = NewImageFromRequest(ImageUpgradeEvaluationRequest{
+		Image:      "registry.local.lan/team/app:1.5.6",
+		TagPattern: `(?P<major>\d+)\.(?P<minor>\d+)\.(?P<patch>\d+)-(?P<variant>alpine[\d.]+)`,
+	}, &cfg)
+	if err == nil {
+		t.Error("Expected failure parsing a tag not matching the pattern")
+	}
+}
+
+func TestEvalUpgradeFlavor(t *testing.T) {
+	cfg := config.NewConfig()
+	request := ImageUpgradeEvaluationRequest{Image: "postgres:14.5-alpine3.16", Loose: true}
+	image, err := NewImageFromRequest(request, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := staticTagSource{"14.5-alpine3.16", "14.9-alpine3.16", "14.9-alpine3.18", "14.9", "15.0-alpine3.18"}
+	if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	evaluation, err := image.EvalUpgrade("< 15.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !evaluation.Stale ||
+		evaluation.NextVersion != "14.9-alpine3.18" ||
+		evaluation.CurrentFlavor != "alpine3.16" ||
+		evaluation.NextFlavor != "alpine3.18" {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+}
+
+type EvaluateTestCase struct {
+	Request           ImageUpgradeEvaluationRequest
+	ExpectedNext      string
+	ExpectedStale     bool
+	ExpectedPlatforms int
+	ExpectedHeldBack  int
+}
+
+func TestEvaluateWithRegistry(t *testing.T) {
+	now := time.Now()
+
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.RequireAuth("user", "secret")
+	reg.AddImage("team/app", "1.0.0", registrytest.Image{Created: now.Add(-400 * 24 * time.Hour)})
+	reg.AddImage("team/app", "1.1.0",
+		registrytest.Image{Platform: "linux/amd64", Created: now.Add(-30 * 24 * time.Hour)},
+		registrytest.Image{Platform: "linux/arm64/v8", Created: now.Add(-30 * 24 * time.Hour)})
+	reg.AddImage("team/app", "1.2.0", registrytest.Image{Created: now.Add(-time.Hour)})
+	reg.AddTags("team/app", "2.0.0", "latest")
+	// the tag list is unavailable for a while
+	reg.Fail("/v2/team/app/tags/list", registrytest.Failure{StatusCode: http.StatusServiceUnavailable, Times: 2})
+
+	cfg := reg.Config()
+	rc := cfg.Registries[reg.Host()]
+	rc.Username = "user"
+	rc.Password = "secret"
+	cfg.Registries[reg.Host()] = rc
+
+	testCases := []EvaluateTestCase{
+		EvaluateTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Constraint: ">= 1.0.0 < 2.0.0"},
+			ExpectedNext:  "1.2.0",
+			ExpectedStale: true,
+		},
+		EvaluateTestCase{
+			Request:           ImageUpgradeEvaluationRequest{Constraint: ">= 1.0.0 < 2.0.0", Platform: "linux/arm64"},
+			ExpectedNext:      "1.1.0",
+			ExpectedStale:     true,
+			ExpectedPlatforms: 2,
+		},
+		EvaluateTestCase{
+			Request:          ImageUpgradeEvaluationRequest{Constraint: ">= 1.0.0 < 2.0.0", MinReleaseAge: "7d"},
+			ExpectedNext:     "1.1.0",
+			ExpectedStale:    true,
+			ExpectedHeldBack: 1,
+		},
+		EvaluateTestCase{
+			// no newer tag, but the image is too old
+			Request:       ImageUpgradeEvaluationRequest{Constraint: "< 1.1.0", MaxAge: "1y"},
+			ExpectedNext:  "1.0.0",
+			ExpectedStale: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc.Request.Image = reg.Host() + "/team/app:1.0.0"
+		image, err := NewImage(tc.Request.Image, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = image.FetchTags(context.Background(), cfg); err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		evaluation, err := image.Evaluate(context.Background(), cfg, tc.Request)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if evaluation.NextVersion != tc.ExpectedNext ||
+			evaluation.Stale != tc.ExpectedStale ||
+			len(evaluation.Platforms) != tc.ExpectedPlatforms ||
+			len(evaluation.HeldBack) != tc.ExpectedHeldBack {
+			t.Errorf("Unexpected evaluation for test case %+v, got %+v", tc, evaluation)
+		}
+	}
+
+	// the two failures have been retried, only the first check has been
+	// challenged: the token is reused by the next ones
+	if reg.Requests("/v2/team/app/tags/list") != 2+1+len(testCases) {
+		t.Errorf("Unexpected number of tag list requests: %d", reg.Requests("/v2/team/app/tags/list"))
+	}
+}
+
+type ValidateRequestTestCase struct {
+	Request       ImageUpgradeEvaluationRequest
+	ExpectedError bool
+}
+
+func TestValidateRequest(t *testing.T) {
+	testCases := []ValidateRequestTestCase{
+		ValidateRequestTestCase{
+			Request: ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", Strategy: "nearest", Platform: "linux/arm64", MaxAge: "90d"},
+		},
+		ValidateRequestTestCase{
+			Request: ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Policy: "minor", Scheme: SchemeCalver},
+		},
+		ValidateRequestTestCase{
+			Request: ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0@sha256:1111", Digest: true},
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", Policy: "minor"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Digest: true, Exclude: []string{"1.22.0"}},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Digest: true, MinReleaseAge: "3d"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "oci:/tmp/layout:app:1.0.0", Constraint: "^1.0", Platform: "linux/amd64"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Policy: "sometimes"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", Strategy: "random"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", MaxAge: "forever"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", Platform: "amd64"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", Scheme: "romver"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", TagPattern: "(?P<major>"},
+			ExpectedError: true,
+		},
+		ValidateRequestTestCase{
+			Request:       ImageUpgradeEvaluationRequest{Image: "nginx:1.21.0", Constraint: "^1.21", Exclude: []string{"/[/"}},
+			ExpectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := tc.Request.Validate()
+		if tc.ExpectedError && err == nil {
+			t.Errorf("Expected failure validating test case %+v", tc)
+		}
+		if !tc.ExpectedError && err != nil {
+			t.Errorf("Unexpected error for test case %+v: %v", tc, err)
+		}
+	}
+}
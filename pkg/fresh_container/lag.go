@@ -0,0 +1,155 @@
+package fresh_container
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+var lagMetrics = []string{"releases", "majors", "minors", "patches"}
+
+// VersionLag measures how far the current version is behind the next
+// one. Each release following the current version, up to the next one,
+// is counted as a major, a minor or a patch release depending on the
+// first component it bumps compared to the release preceding it.
+type VersionLag struct {
+	Releases int `json:"releases"`
+	Majors   int `json:"majors"`
+	Minors   int `json:"minors"`
+	Patches  int `json:"patches"`
+	// Versions between the current and the next one, in ascending order
+	Intermediate []string `json:"intermediate"`
+}
+
+// IntermediateVersions returns, in ascending order, the versions greater
+// than the current one and lower than the next one. Like `NextVersion`,
+// only the versions whose flavor belongs to the family of the current
+// one are considered.
+func IntermediateVersions(scheme VersionScheme, curVer, nextVer semver.Version, versions semver.Versions) semver.Versions {
+	family := ParseFlavor(curVer).Family
+	intermediate := semver.Versions{}
+	for _, v := range versions {
+		if ParseFlavor(v).Family == family &&
+			compareFlavored(scheme, v, curVer) > 0 &&
+			compareFlavored(scheme, v, nextVer) < 0 {
+			intermediate = append(intermediate, v)
+		}
+	}
+	sort.Slice(intermediate, func(i, j int) bool {
+		return compareFlavored(scheme, intermediate[i], intermediate[j]) < 0
+	})
+
+	return intermediate
+}
+
+// lag returns the lag of the current version behind the next one,
+// nil when the next version is not greater than the current one
+func (image *Image) lag(nextVer semver.Version) *VersionLag {
+	if image.compareVersions(nextVer, image.TagVersion) <= 0 {
+		return nil
+	}
+
+	lag := &VersionLag{Intermediate: []string{}}
+	intermediate := IntermediateVersions(image.versionScheme(), image.TagVersion, nextVer, image.TagVersions)
+	previous := image.TagVersion
+	for _, v := range append(intermediate, nextVer) {
+		switch {
+		case v.Major != previous.Major:
+			lag.Majors++
+		case v.Minor != previous.Minor:
+			lag.Minors++
+		default:
+			lag.Patches++
+		}
+		lag.Releases++
+		previous = v
+	}
+	for _, v := range intermediate {
+		lag.Intermediate = append(lag.Intermediate, image.versionName(v))
+	}
+
+	return lag
+}
+
+// LagThreshold is exceeded when a metric of the lag is greater than the
+// value, e.g. `minors>2`, or greater than or equal to it, e.g. `majors>=1`
+type LagThreshold struct {
+	Metric   string
+	Operator string
+	Value    int
+}
+
+// ParseLagThresholds parses a comma separated list of thresholds, like
+// `majors>0,minors>2`. The metrics are `releases`, `majors`, `minors`
+// and `patches`.
+func ParseLagThresholds(expr string) ([]LagThreshold, error) {
+	thresholds := []LagThreshold{}
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+
+		i := strings.IndexAny(term, "<>=")
+		if i < 0 {
+			return nil, fmt.Errorf("Invalid threshold %s: expected <metric>><value> or <metric>>=<value>", term)
+		}
+		threshold := LagThreshold{Metric: strings.TrimSpace(term[:i]), Operator: ">"}
+		value := term[i:]
+		switch {
+		case strings.HasPrefix(value, ">="):
+			threshold.Operator = ">="
+			value = value[2:]
+		case strings.HasPrefix(value, ">"):
+			value = value[1:]
+		default:
+			return nil, fmt.Errorf("Invalid threshold %s: only the > and >= operators are supported", term)
+		}
+
+		if !isLagMetric(threshold.Metric) {
+			return nil, fmt.Errorf("Invalid threshold %s: unknown metric %s. Valid ones are %+v", term, threshold.Metric, lagMetrics)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid threshold %s: %s is not a valid number", term, value)
+		}
+		threshold.Value = n
+
+		thresholds = append(thresholds, threshold)
+	}
+
+	return thresholds, nil
+}
+
+func isLagMetric(metric string) bool {
+	for _, m := range lagMetrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// ExceededBy returns true when the lag exceeds the threshold
+func (t LagThreshold) ExceededBy(lag VersionLag) bool {
+	var value int
+	switch t.Metric {
+	case "releases":
+		value = lag.Releases
+	case "majors":
+		value = lag.Majors
+	case "minors":
+		value = lag.Minors
+	case "patches":
+		value = lag.Patches
+	}
+
+	if t.Operator == ">=" {
+		return value >= t.Value
+	}
+	return value > t.Value
+}
+
+func (t LagThreshold) String() string {
+	return fmt.Sprintf("%s%s%d", t.Metric, t.Operator, t.Value)
+}
@@ -0,0 +1,124 @@
+package fresh_container
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type VersionLagTestCase struct {
+	CurTag     string
+	Constraint string
+	Expected   *VersionLag
+}
+
+func TestEvalUpgradeLag(t *testing.T) {
+	tags := staticTagSource{
+		"1.2.3",
+		"1.2.4",
+		"1.2.4-alpine",
+		"1.3.0",
+		"1.3.1",
+		"1.4.0-rc1",
+		"2.0.0",
+		"2.1.0",
+	}
+
+	testCases := []VersionLagTestCase{
+		VersionLagTestCase{
+			CurTag:     "1.2.3",
+			Constraint: "*",
+			Expected:   &VersionLag{Releases: 5, Majors: 1, Minors: 2, Patches: 2, Intermediate: []string{"1.2.4", "1.3.0", "1.3.1", "2.0.0"}},
+		},
+		VersionLagTestCase{
+			CurTag:     "1.2.3",
+			Constraint: "< 2.0.0",
+			Expected:   &VersionLag{Releases: 3, Minors: 1, Patches: 2, Intermediate: []string{"1.2.4", "1.3.0"}},
+		},
+		VersionLagTestCase{
+			CurTag: "1.2.3",
+			// no newer version, no lag
+			Constraint: "< 1.2.4",
+			Expected:   nil,
+		},
+		VersionLagTestCase{
+			// only the tags of the same flavor are counted
+			CurTag:     "1.2.3-alpine",
+			Constraint: "*",
+			Expected:   &VersionLag{Releases: 1, Patches: 1, Intermediate: []string{}},
+		},
+	}
+
+	for _, tc := range testCases {
+		image, err := NewImage("registry.local.lan/team/app:"+tc.CurTag, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		evaluation, err := image.EvalUpgrade(tc.Constraint)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if !reflect.DeepEqual(evaluation.Lag, tc.Expected) {
+			t.Errorf("Unexpected lag for test case %+v, got %+v", tc, evaluation.Lag)
+		}
+
+		data, err := json.Marshal(evaluation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if omitted := !strings.Contains(string(data), `"lag":`); omitted != (tc.Expected == nil) {
+			t.Errorf("Unexpected JSON encoding for test case %+v: %s", tc, data)
+		}
+	}
+}
+
+type LagThresholdTestCase struct {
+	Expr     string
+	Lag      VersionLag
+	Exceeded bool
+	Invalid  bool
+}
+
+func TestLagThresholds(t *testing.T) {
+	lag := VersionLag{Releases: 4, Majors: 0, Minors: 2, Patches: 2}
+
+	testCases := []LagThresholdTestCase{
+		LagThresholdTestCase{Expr: "minors>2", Lag: lag, Exceeded: false},
+		LagThresholdTestCase{Expr: "minors>=2", Lag: lag, Exceeded: true},
+		LagThresholdTestCase{Expr: "majors>0, releases>3", Lag: lag, Exceeded: true},
+		LagThresholdTestCase{Expr: "majors>0,patches>5", Lag: lag, Exceeded: false},
+		LagThresholdTestCase{Expr: "minors<2", Invalid: true},
+		LagThresholdTestCase{Expr: "weeks>2", Invalid: true},
+		LagThresholdTestCase{Expr: "minors>two", Invalid: true},
+		LagThresholdTestCase{Expr: "minors", Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		thresholds, err := ParseLagThresholds(tc.Expr)
+		if tc.Invalid {
+			if err == nil {
+				t.Errorf("Expected failure parsing test case %+v", tc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		exceeded := false
+		for _, threshold := range thresholds {
+			exceeded = exceeded || threshold.ExceededBy(tc.Lag)
+		}
+		if exceeded != tc.Exceeded {
+			t.Errorf("Unexpected result for test case %+v", tc)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package fresh_container
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// OCI image layout directory, see
+	// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+	LocalTransportOCI = "oci"
+	// Tarball created by `docker save`, or a directory holding them
+	LocalTransportDockerArchive = "docker-archive"
+
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// localSource describes images stored on the local filesystem
+// instead of a registry
+type localSource struct {
+	Transport string
+	Path      string
+	Name      string
+}
+
+type ociIndex struct {
+	Manifests []struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"manifests"`
+}
+
+type dockerArchiveManifest []struct {
+	RepoTags []string `json:"RepoTags"`
+}
+
+// IsLocalReference returns true when the image is referenced
+// using one of the local transports, like `oci:/path/to/layout:app:1.2.3`
+func IsLocalReference(image string) bool {
+	for _, transport := range []string{LocalTransportOCI, LocalTransportDockerArchive} {
+		if strings.HasPrefix(image, transport+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLocalReference parses references like `oci:/path/to/layout:app:1.2.3`
+// or `docker-archive:/path/to/image.tar:app:1.2.3`. It returns the local
+// source together with the `name:tag` part of the reference.
+func parseLocalReference(image string) (localSource, string, error) {
+	parts := strings.SplitN(image, ":", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return localSource{}, "", fmt.Errorf(
+			"Invalid local image reference %s: must be expressed as <transport>:<path>:<name>:<tag>",
+			image)
+	}
+
+	ref := parts[2]
+	if !strings.Contains(ref, ":") {
+		return localSource{}, "", fmt.Errorf(
+			"Invalid local image reference %s: the tag of the image is missing",
+			image)
+	}
+
+	return localSource{
+		Transport: parts[0],
+		Path:      parts[1],
+		Name:      ref[:strings.LastIndex(ref, ":")],
+	}, ref, nil
+}
+
+func (s *localSource) String() string {
+	return fmt.Sprintf("%s:%s:%s", s.Transport, s.Path, s.Name)
+}
+
+// Tags returns the tags of the image found inside of the local source,
+// it implements the `TagSource` interface
+func (s *localSource) Tags(ctx context.Context, image *Image) ([]string, error) {
+	var tags []string
+	var err error
+	switch s.Transport {
+	case LocalTransportOCI:
+		tags, err = s.ociTags()
+	case LocalTransportDockerArchive:
+		tags, err = s.dockerArchiveTags()
+	default:
+		return []string{}, fmt.Errorf("Unknown local transport %s", s.Transport)
+	}
+	if err != nil {
+		return []string{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"image": s.String(),
+		"tags":  len(tags),
+	}).Debug("Read image tags from the local filesystem")
+
+	return tags, nil
+}
+
+// ociTags reads the `index.json` file of an OCI image layout. The
+// `org.opencontainers.image.ref.name` annotation can either hold a
+// tag or a full image reference, in the latter case only the references
+// of the image are taken into account.
+func (s *localSource) ociTags() ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Path, "index.json"))
+	if err != nil {
+		return []string{}, err
+	}
+
+	var index ociIndex
+	if err = json.Unmarshal(data, &index); err != nil {
+		return []string{}, fmt.Errorf("Cannot parse the index of the %s OCI layout: %v", s.Path, err)
+	}
+
+	refs := []string{}
+	for _, m := range index.Manifests {
+		if refName, found := m.Annotations[ociRefNameAnnotation]; found {
+			refs = append(refs, refName)
+		}
+	}
+
+	return s.matchingTags(refs)
+}
+
+// dockerArchiveTags reads the `RepoTags` of the `manifest.json` file
+// created by `docker save`. The path can be a tarball, an extracted
+// tarball or a directory holding multiple tarballs.
+func (s *localSource) dockerArchiveTags() ([]string, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return []string{}, err
+	}
+
+	archives := []string{s.Path}
+	if info.IsDir() {
+		extracted := filepath.Join(s.Path, "manifest.json")
+		if _, err := os.Stat(extracted); err == nil {
+			data, err := ioutil.ReadFile(extracted)
+			if err != nil {
+				return []string{}, err
+			}
+			return s.repoTags(data)
+		}
+
+		archives, err = filepath.Glob(filepath.Join(s.Path, "*.tar*"))
+		if err != nil {
+			return []string{}, err
+		}
+	}
+
+	tags := []string{}
+	for _, archive := range archives {
+		data, err := readArchiveManifest(archive)
+		if err != nil {
+			return []string{}, err
+		}
+
+		archiveTags, err := s.repoTags(data)
+		if err != nil {
+			return []string{}, err
+		}
+		tags = append(tags, archiveTags...)
+	}
+
+	return tags, nil
+}
+
+func (s *localSource) repoTags(manifestData []byte) ([]string, error) {
+	var manifest dockerArchiveManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return []string{}, fmt.Errorf("Cannot parse the manifest of the %s docker archive: %v", s.Path, err)
+	}
+
+	refs := []string{}
+	for _, entry := range manifest {
+		refs = append(refs, entry.RepoTags...)
+	}
+
+	return s.matchingTags(refs)
+}
+
+// matchingTags returns the tags of the references that belong to the image.
+// References made only by a tag are always taken into account.
+func (s *localSource) matchingTags(refs []string) ([]string, error) {
+	wanted, err := registry.ParseImage(s.Name)
+	if err != nil {
+		return []string{}, err
+	}
+
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		tag := ref
+		if strings.ContainsAny(ref, ":/") {
+			img, err := registry.ParseImage(ref)
+			if err != nil || img.Domain != wanted.Domain || img.Path != wanted.Path {
+				continue
+			}
+			tag = img.Tag
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// readArchiveManifest extracts the `manifest.json` file from a
+// tarball, which can optionally be compressed with gzip
+func readArchiveManifest(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	var reader io.Reader = buffered
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("The %s docker archive does not contain a manifest.json file", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read the %s docker archive: %v", path, err)
+		}
+
+		if filepath.Clean(header.Name) == "manifest.json" {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package fresh_container
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+const ociIndexJSON = `{
+  "schemaVersion": 2,
+  "manifests": [
+    {"annotations": {"org.opencontainers.image.ref.name": "1.2.3"}},
+    {"annotations": {"org.opencontainers.image.ref.name": "docker.io/library/app:1.3.0"}},
+    {"annotations": {"org.opencontainers.image.ref.name": "other:2.0.0"}},
+    {"annotations": {}}
+  ]
+}`
+
+const dockerArchiveManifestJSON = `[
+  {"Config": "config.json", "RepoTags": ["app:1.2.3", "app:1.4.0", "registry.local.lan/app:2.0.0"]}
+]`
+
+func writeDockerArchive(t *testing.T, path string, compress bool) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var tw *tar.Writer
+	if compress {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(file)
+	}
+	defer tw.Close()
+
+	err = tw.WriteHeader(&tar.Header{
+		Name: "manifest.json",
+		Mode: 0644,
+		Size: int64(len(dockerArchiveManifestJSON)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tw.Write([]byte(dockerArchiveManifestJSON)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type LocalSourceTestCase struct {
+	Image       string
+	Constraint  string
+	ExpectedTag string
+}
+
+func TestLocalSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fresh-container-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	layout := filepath.Join(dir, "layout")
+	if err = os.Mkdir(layout, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(layout, "index.json"), []byte(ociIndexJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archives := filepath.Join(dir, "archives")
+	if err = os.Mkdir(archives, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeDockerArchive(t, filepath.Join(dir, "app.tar"), false)
+	writeDockerArchive(t, filepath.Join(archives, "app.tar.gz"), true)
+
+	testCases := []LocalSourceTestCase{
+		LocalSourceTestCase{
+			Image:       "oci:" + layout + ":app:1.2.3",
+			Constraint:  ">= 1.0.0",
+			ExpectedTag: "1.3.0",
+		},
+		LocalSourceTestCase{
+			Image:       "docker-archive:" + filepath.Join(dir, "app.tar") + ":app:1.2.3",
+			Constraint:  ">= 1.0.0",
+			ExpectedTag: "1.4.0",
+		},
+		LocalSourceTestCase{
+			Image:       "docker-archive:" + archives + ":registry.local.lan/app:1.0.0",
+			Constraint:  ">= 1.0.0",
+			ExpectedTag: "2.0.0",
+		},
+	}
+
+	cfg := config.NewConfig()
+	for _, tc := range testCases {
+		image, err := NewImage(tc.Image, "")
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		if err = image.FetchTags(context.Background(), &cfg); err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		evaluation, err := image.EvalUpgrade(tc.Constraint)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		if evaluation.NextVersion != tc.ExpectedTag {
+			t.Errorf("Unexpected next tag for test case %+v, got %s instead of %s",
+				tc,
+				evaluation.NextVersion,
+				tc.ExpectedTag)
+		}
+	}
+}
+
+func TestInvalidLocalReference(t *testing.T) {
+	for _, ref := range []string{"oci:", "oci:/path/to/layout", "oci:/path/to/layout:app"} {
+		if _, err := NewImage(ref, ""); err == nil {
+			t.Errorf("Expected failure parsing invalid local reference %s", ref)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// Platform describes the operating system and the architecture
+// an image has been built for
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ParsePlatform parses platforms expressed as `os/arch[/variant]`,
+// like `linux/amd64` or `linux/arm/v7`
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("Invalid platform %s: must be expressed as os/arch[/variant]", platform)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return Platform{}, fmt.Errorf("Invalid platform %s: must be expressed as os/arch[/variant]", platform)
+		}
+	}
+
+	p := Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+
+	return p, nil
+}
+
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return fmt.Sprintf("%s/%s", p.OS, p.Architecture)
+	}
+	return fmt.Sprintf("%s/%s/%s", p.OS, p.Architecture, p.Variant)
+}
+
+// Satisfies returns true when images built for the platform can be
+// used on the required one. The variant is taken into account only
+// when it is part of the requirement.
+func (p Platform) Satisfies(required Platform) bool {
+	if p.OS != required.OS || p.Architecture != required.Architecture {
+		return false
+	}
+	if required.Variant == "" {
+		return true
+	}
+
+	return p.normalizedVariant() == required.normalizedVariant()
+}
+
+// normalizedVariant returns the variant of the platform, taking into
+// account the default ones that are often omitted
+func (p Platform) normalizedVariant() string {
+	if p.Variant == "" && p.Architecture == "arm64" {
+		return "v8"
+	}
+	return p.Variant
+}
+
+func platformNames(platforms []Platform) []string {
+	names := []string{}
+	for _, p := range platforms {
+		names = append(names, p.String())
+	}
+	return names
+}
+
+func supportsPlatform(platforms []Platform, required Platform) bool {
+	for _, p := range platforms {
+		if p.Satisfies(required) {
+			return true
+		}
+	}
+	return false
+}
+
+// platformFilter rejects the tags that do not publish an image for
+// the platform. The platforms published by the last tag inspected
+// are stored into `platforms`.
+func (image *Image) platformFilter(ctx context.Context, platform Platform, platforms *[]Platform) candidateFilter {
+	return func(r *registry.Registry, location registries.Location, tag string, current bool) (bool, error) {
+		var err error
+		*platforms, err = listPlatforms(ctx, r, location.Path, tag)
+		if err != nil {
+			return false, err
+		}
+
+		supported := supportsPlatform(*platforms, platform)
+		if current && !supported {
+			log.WithFields(log.Fields{
+				"image":     image.FullNameWithTag(),
+				"platform":  platform.String(),
+				"platforms": platformNames(*platforms),
+			}).Warn("The current tag does not publish an image for the requested platform")
+		} else if !supported {
+			image.explanation.record(tag, false, "does not publish an image for the %s platform", platform.String())
+			log.WithFields(log.Fields{
+				"image":     image.FullNameWithoutTag(),
+				"tag":       tag,
+				"platform":  platform.String(),
+				"platforms": platformNames(*platforms),
+			}).Debug("Skipping tag that does not publish an image for the requested platform")
+		}
+
+		return supported, nil
+	}
+}
+
+func removeVersion(scheme VersionScheme, versions semver.Versions, version semver.Version) semver.Versions {
+	filtered := semver.Versions{}
+	for _, v := range versions {
+		if scheme.Compare(v, version) != 0 {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// listPlatforms returns the platforms published by the given tag.
+// Manifest lists provide them straight away, while the configuration
+// of single manifest images has to be read.
+func listPlatforms(ctx context.Context, r *registry.Registry, repository, tag string) ([]Platform, error) {
+	m, err := fetchManifest(ctx, r, repository, tag)
+	if err != nil {
+		return []Platform{}, err
+	}
+
+	platforms := []Platform{}
+	if len(m.Manifests) > 0 {
+		for _, entry := range m.Manifests {
+			// skip attestations and other artifacts that are not images
+			if entry.Platform.OS == "" || entry.Platform.OS == "unknown" {
+				continue
+			}
+			platforms = append(platforms, entry.Platform)
+		}
+		return platforms, nil
+	}
+
+	imgConfig, err := fetchImageConfig(ctx, r, repository, m.Config.Digest)
+	if err != nil {
+		return []Platform{}, err
+	}
+
+	return append(platforms, Platform{
+		OS:           imgConfig.OS,
+		Architecture: imgConfig.Architecture,
+		Variant:      imgConfig.Variant,
+	}), nil
+}
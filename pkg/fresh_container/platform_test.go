@@ -0,0 +1,199 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+type ParsePlatformTestCase struct {
+	Platform string
+	Expected Platform
+	Invalid  bool
+}
+
+func TestParsePlatform(t *testing.T) {
+	testCases := []ParsePlatformTestCase{
+		ParsePlatformTestCase{Platform: "linux/amd64", Expected: Platform{OS: "linux", Architecture: "amd64"}},
+		ParsePlatformTestCase{Platform: "linux/arm/v7", Expected: Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		ParsePlatformTestCase{Platform: "linux", Invalid: true},
+		ParsePlatformTestCase{Platform: "linux/", Invalid: true},
+		ParsePlatformTestCase{Platform: "linux/arm/v7/extra", Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		p, err := ParsePlatform(tc.Platform)
+		if tc.Invalid {
+			if err == nil {
+				t.Errorf("Expected failure parsing test case %+v, got %+v", tc, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if p != tc.Expected || p.String() != tc.Platform {
+			t.Errorf("Unexpected platform for test case %+v, got %+v", tc, p)
+		}
+	}
+}
+
+type SatisfiesTestCase struct {
+	Platform Platform
+	Required Platform
+	Expected bool
+}
+
+func TestPlatformSatisfies(t *testing.T) {
+	testCases := []SatisfiesTestCase{
+		SatisfiesTestCase{Platform: Platform{"linux", "amd64", ""}, Required: Platform{"linux", "amd64", ""}, Expected: true},
+		SatisfiesTestCase{Platform: Platform{"linux", "arm", "v7"}, Required: Platform{"linux", "arm", ""}, Expected: true},
+		SatisfiesTestCase{Platform: Platform{"linux", "arm", "v6"}, Required: Platform{"linux", "arm", "v7"}, Expected: false},
+		// the arm64 variant is often omitted
+		SatisfiesTestCase{Platform: Platform{"linux", "arm64", ""}, Required: Platform{"linux", "arm64", "v8"}, Expected: true},
+		SatisfiesTestCase{Platform: Platform{"windows", "amd64", ""}, Required: Platform{"linux", "amd64", ""}, Expected: false},
+	}
+
+	for _, tc := range testCases {
+		if satisfied := tc.Platform.Satisfies(tc.Required); satisfied != tc.Expected {
+			t.Errorf("Unexpected result for test case %+v, got %v", tc, satisfied)
+		}
+	}
+}
+
+// newPlatformRegistry serves the tags of the `team/app` repository.
+// Each tag publishes the platforms listed by the map: tags with more
+// than one platform use a manifest list, the others a single manifest.
+func newPlatformRegistry(platforms map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/team/app/tags/list":
+			tags := []string{}
+			for tag := range platforms {
+				tags = append(tags, fmt.Sprintf("%q", tag))
+			}
+			fmt.Fprintf(w, `{"tags": [%s]}`, strings.Join(tags, ", "))
+		case strings.HasPrefix(r.URL.Path, "/v2/team/app/manifests/"):
+			tag := strings.TrimPrefix(r.URL.Path, "/v2/team/app/manifests/")
+			published, found := platforms[tag]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if len(published) == 1 {
+				fmt.Fprintf(w, `{"schemaVersion": 2, "config": {"digest": "sha256:%s"}}`, strings.Replace(published[0], "/", "-", -1))
+				return
+			}
+			entries := []string{
+				// attestations are not images
+				`{"digest": "sha256:attestation", "platform": {"os": "unknown", "architecture": "unknown"}}`,
+			}
+			for _, platform := range published {
+				p, _ := ParsePlatform(platform)
+				entries = append(entries, fmt.Sprintf(`{"digest": "sha256:%s", "platform": {"os": %q, "architecture": %q, "variant": %q}}`,
+					strings.Replace(platform, "/", "-", -1), p.OS, p.Architecture, p.Variant))
+			}
+			fmt.Fprintf(w, `{"schemaVersion": 2, "manifests": [%s]}`, strings.Join(entries, ", "))
+		case strings.HasPrefix(r.URL.Path, "/v2/team/app/blobs/sha256:"):
+			p, _ := ParsePlatform(strings.Replace(strings.TrimPrefix(r.URL.Path, "/v2/team/app/blobs/sha256:"), "-", "/", -1))
+			fmt.Fprintf(w, `{"os": %q, "architecture": %q, "variant": %q}`, p.OS, p.Architecture, p.Variant)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestListPlatforms(t *testing.T) {
+	srv := newPlatformRegistry(map[string][]string{
+		"1.0.0": []string{"linux/amd64"},
+		"1.1.0": []string{"linux/amd64", "linux/arm/v7"},
+	})
+	defer srv.Close()
+
+	platforms, err := listPlatforms(context.Background(), newTestRegistry(srv), "team/app", "1.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(platformNames(platforms), []string{"linux/amd64"}) {
+		t.Errorf("Unexpected platforms %+v", platforms)
+	}
+
+	platforms, err = listPlatforms(context.Background(), newTestRegistry(srv), "team/app", "1.1.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(platformNames(platforms), []string{"linux/amd64", "linux/arm/v7"}) {
+		t.Errorf("Unexpected platforms %+v", platforms)
+	}
+}
+
+type PlatformEvaluationTestCase struct {
+	Platform          string
+	ExpectedNext      string
+	ExpectedPlatforms []string
+}
+
+func TestEvaluatePlatform(t *testing.T) {
+	srv := newPlatformRegistry(map[string][]string{
+		"1.0.0": []string{"linux/amd64", "linux/arm64"},
+		"1.1.0": []string{"linux/amd64", "linux/arm64/v8"},
+		"1.2.0": []string{"linux/amd64"},
+		"2.0.0": []string{"linux/amd64", "linux/arm64"},
+	})
+	defer srv.Close()
+
+	host, rc := newTestRegistryConfig(srv)
+	rc.MaxRetries = -1
+	cfg := config.NewConfig()
+	cfg.Registries = map[string]config.RegistryConfig{host: rc}
+
+	testCases := []PlatformEvaluationTestCase{
+		PlatformEvaluationTestCase{Platform: "linux/amd64", ExpectedNext: "1.2.0", ExpectedPlatforms: []string{"linux/amd64"}},
+		// 1.2.0 is skipped
+		PlatformEvaluationTestCase{Platform: "linux/arm64", ExpectedNext: "1.1.0", ExpectedPlatforms: []string{"linux/amd64", "linux/arm64/v8"}},
+		// no candidate, the current version is kept
+		PlatformEvaluationTestCase{Platform: "windows/amd64", ExpectedNext: "1.0.0", ExpectedPlatforms: []string{"linux/amd64", "linux/arm64"}},
+	}
+
+	for _, tc := range testCases {
+		request := ImageUpgradeEvaluationRequest{
+			Image:      host + "/team/app:1.0.0",
+			Constraint: "< 2.0.0",
+			Platform:   tc.Platform,
+		}
+		image, err := NewImage(request.Image, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = image.FetchTags(context.Background(), &cfg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		evaluation, err := image.Evaluate(context.Background(), &cfg, request)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if evaluation.NextVersion != tc.ExpectedNext ||
+			evaluation.Platform != tc.Platform ||
+			!reflect.DeepEqual(evaluation.Platforms, tc.ExpectedPlatforms) {
+			t.Errorf("Unexpected evaluation for test case %+v, got %+v", tc, evaluation)
+		}
+	}
+
+	// the platform must be valid
+	image, err := NewImage(host+"/team/app:1.0.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = image.Evaluate(context.Background(), &cfg, ImageUpgradeEvaluationRequest{Constraint: "< 2.0.0", Platform: "linux"}); err == nil {
+		t.Error("Expected an error for an invalid platform")
+	}
+}
@@ -0,0 +1,96 @@
+package fresh_container
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// UpdatePolicy tells which upgrades are allowed, relatively to the
+// current version, without writing a constraint
+type UpdatePolicy string
+
+const (
+	// Same major and minor versions, e.g. `>=1.9.3 <1.10.0`
+	PolicyPatch UpdatePolicy = "patch"
+	// Same major version, e.g. `>=1.9.3 <2.0.0`
+	PolicyMinor UpdatePolicy = "minor"
+	// Any newer version, e.g. `>=1.9.3`
+	PolicyMajor UpdatePolicy = "major"
+	// Any version, e.g. `*`
+	PolicyAny UpdatePolicy = "any"
+)
+
+var UpdatePolicies = []UpdatePolicy{PolicyPatch, PolicyMinor, PolicyMajor, PolicyAny}
+
+// ParseUpdatePolicy returns the policy with the given name
+func ParseUpdatePolicy(policy string) (UpdatePolicy, error) {
+	for _, p := range UpdatePolicies {
+		if string(p) == policy {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown update policy %s. Valid ones are %+v", policy, UpdatePolicies)
+}
+
+// Constraint returns the constraint implementing the policy for the
+// current version, expressed using the version scheme. The flavor of
+// the current version is not part of the constraint, see `NextVersion`.
+// Calendar versions have no patch and minor releases: the `patch`
+// policy keeps the same month and the `minor` one the same year.
+func (p UpdatePolicy) Constraint(scheme VersionScheme, current semver.Version) string {
+	current = withoutPre(current)
+	lower := ">=" + scheme.Format(current)
+
+	var upper semver.Version
+	switch p {
+	case PolicyAny:
+		return "*"
+	case PolicyMajor:
+		return lower
+	case PolicyMinor:
+		upper = semver.Version{Major: current.Major + 1}
+	case PolicyPatch:
+		upper = semver.Version{Major: current.Major, Minor: current.Minor + 1}
+	}
+
+	switch scheme.(type) {
+	case CalverScheme:
+		upper = nextPeriod(p, current)
+	case DateScheme:
+		// date stamps always have a day
+		upper = nextPeriod(p, current)
+		upper.Patch = 1
+	}
+
+	return fmt.Sprintf("%s <%s", lower, scheme.Format(upper))
+}
+
+// nextPeriod returns the first day of the month, or of the year,
+// following the calendar version
+func nextPeriod(p UpdatePolicy, current semver.Version) semver.Version {
+	start := time.Date(int(current.Major), time.Month(current.Minor), 1, 0, 0, 0, 0, time.UTC)
+	if p == PolicyMinor {
+		start = start.AddDate(1, 1-int(start.Month()), 0)
+	} else {
+		start = start.AddDate(0, 1, 0)
+	}
+
+	return semver.Version{Major: uint64(start.Year()), Minor: uint64(start.Month())}
+}
+
+// RequestConstraint returns the constraint of the evaluation: the one
+// derived from the policy of the request, when set, see
+// `UpdatePolicy.Constraint`
+func (image *Image) RequestConstraint(request ImageUpgradeEvaluationRequest) (string, error) {
+	if request.Policy == "" {
+		return request.Constraint, nil
+	}
+
+	policy, err := ParseUpdatePolicy(request.Policy)
+	if err != nil {
+		return "", err
+	}
+	return policy.Constraint(image.versionScheme(), image.TagVersion), nil
+}
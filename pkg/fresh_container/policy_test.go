@@ -0,0 +1,97 @@
+package fresh_container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+type UpdatePolicyTestCase struct {
+	Scheme     string
+	Policy     string
+	Tag        string
+	Constraint string
+}
+
+func TestUpdatePolicyConstraint(t *testing.T) {
+	testCases := []UpdatePolicyTestCase{
+		UpdatePolicyTestCase{Scheme: SchemeSemver, Policy: "patch", Tag: "1.9.3", Constraint: ">=1.9.3 <1.10.0"},
+		UpdatePolicyTestCase{Scheme: SchemeSemver, Policy: "minor", Tag: "1.9.3", Constraint: ">=1.9.3 <2.0.0"},
+		UpdatePolicyTestCase{Scheme: SchemeSemver, Policy: "major", Tag: "1.9.3", Constraint: ">=1.9.3"},
+		UpdatePolicyTestCase{Scheme: SchemeSemver, Policy: "any", Tag: "1.9.3", Constraint: "*"},
+		UpdatePolicyTestCase{Scheme: SchemeSemver, Policy: "patch", Tag: "1.9.3-alpine", Constraint: ">=1.9.3 <1.10.0"},
+		UpdatePolicyTestCase{Scheme: SchemeNumeric, Policy: "patch", Tag: "1.2.3.4", Constraint: ">=1.2.3.4 <1.3.0"},
+		UpdatePolicyTestCase{Scheme: SchemeCalver, Policy: "patch", Tag: "2024.12.15", Constraint: ">=2024.12.15 <2025.01"},
+		UpdatePolicyTestCase{Scheme: SchemeCalver, Policy: "minor", Tag: "2024.03", Constraint: ">=2024.03 <2025.01"},
+		UpdatePolicyTestCase{Scheme: SchemeDate, Policy: "patch", Tag: "20240115", Constraint: ">=20240115 <20240201"},
+		UpdatePolicyTestCase{Scheme: SchemeDate, Policy: "minor", Tag: "20240115", Constraint: ">=20240115 <20250101"},
+	}
+
+	for _, tc := range testCases {
+		scheme, err := NewVersionScheme(tc.Scheme, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy, err := ParseUpdatePolicy(tc.Policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current, err := scheme.Parse(tc.Tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		constraint := policy.Constraint(scheme, current)
+		if constraint != tc.Constraint {
+			t.Errorf("Unexpected constraint for test case %+v, got %s", tc, constraint)
+			continue
+		}
+		if _, err = scheme.ParseConstraint(constraint); err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+		}
+	}
+
+	if _, err := ParseUpdatePolicy("newest"); err == nil {
+		t.Error("Expected failure parsing an unknown policy")
+	}
+}
+
+type PolicyEvaluateTestCase struct {
+	Policy             string
+	ExpectedNext       string
+	ExpectedConstraint string
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	cfg := config.NewConfig()
+	tags := staticTagSource{"1.9.3", "1.9.7", "1.10.2", "2.0.0"}
+
+	testCases := []PolicyEvaluateTestCase{
+		PolicyEvaluateTestCase{Policy: "patch", ExpectedNext: "1.9.7", ExpectedConstraint: ">=1.9.3 <1.10.0"},
+		PolicyEvaluateTestCase{Policy: "minor", ExpectedNext: "1.10.2", ExpectedConstraint: ">=1.9.3 <2.0.0"},
+		PolicyEvaluateTestCase{Policy: "any", ExpectedNext: "2.0.0", ExpectedConstraint: "*"},
+	}
+
+	for _, tc := range testCases {
+		request := ImageUpgradeEvaluationRequest{Image: "nginx:1.9.3", Policy: tc.Policy}
+		image, err := NewImageFromRequest(request, &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = image.FetchTagsFrom(context.Background(), tags); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		evaluation, err := image.Evaluate(context.Background(), &cfg, request)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if !evaluation.Stale ||
+			evaluation.NextVersion != tc.ExpectedNext ||
+			evaluation.Constraint != tc.ExpectedConstraint {
+			t.Errorf("Unexpected evaluation for test case %+v, got %+v", tc, evaluation)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package fresh_container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/flavio/fresh-container/internal/certs"
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/credentials"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+	"github.com/genuinetools/reg/repoutils"
+	"github.com/peterhellberg/link"
+	log "github.com/sirupsen/logrus"
+)
+
+type tagsPage struct {
+	Tags []string `json:"tags"`
+}
+
+type catalogPage struct {
+	Repositories []string `json:"repositories"`
+}
+
+func createRegistryClient(ctx context.Context, location registries.Location, config *config.Config) (*registry.Registry, error) {
+	domain := location.Domain
+
+	// Use the auth-url domain if provided.
+	rc := config.GetRegistryConfig(domain)
+
+	creds, err := credentials.Lookup(ctx, config, domain, location.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := types.AuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		IdentityToken: creds.IdentityToken,
+		RegistryToken: creds.RegistryToken,
+		ServerAddress: rc.AuthDomain,
+	}
+	if auth.ServerAddress == "docker.io" {
+		auth.ServerAddress = repoutils.DefaultDockerRegistry
+	}
+
+	// Prevent non-ssl unless explicitly forced
+	if !rc.NonSSL && strings.HasPrefix(auth.ServerAddress, "http:") {
+		return nil, fmt.Errorf("attempted to use insecure protocol! Use force-non-ssl option to force")
+	}
+
+	tlsConfig, err := certs.TLSConfig(domain, certs.Options{
+		CAFile:   rc.CAFile,
+		CertFile: rc.CertFile,
+		KeyFile:  rc.KeyFile,
+		Dirs:     config.CertsDirs,
+		Insecure: rc.Insecure || location.Insecure,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Registry %s: %v", domain, err)
+	}
+
+	// Create the registry client.
+	return newRegistry(ctx, auth, domain, rc, tlsConfig)
+}
+
+// listTags returns all the tags of the given repository together with
+// the number of pages that have been fetched.
+// A `maxPages` value lower or equal to 0 means no limit.
+func listTags(ctx context.Context, r *registry.Registry, repository string, pageSize, maxPages int) ([]string, int, error) {
+	u := fmt.Sprintf("%s/v2/%s/tags/list", r.URL, repository)
+	r.Logf("registry.tags url=%s", u)
+
+	return listPages(ctx, r, u, pageSize, maxPages, func(body io.Reader) ([]string, error) {
+		var page tagsPage
+		err := json.NewDecoder(body).Decode(&page)
+		return page.Tags, err
+	})
+}
+
+// listRepositories returns all the repositories of the registry, using
+// the `/v2/_catalog` endpoint, together with the number of pages that
+// have been fetched.
+// A `maxPages` value lower or equal to 0 means no limit.
+func listRepositories(ctx context.Context, r *registry.Registry, pageSize, maxPages int) ([]string, int, error) {
+	u := fmt.Sprintf("%s/v2/_catalog", r.URL)
+	r.Logf("registry.catalog url=%s", u)
+
+	return listPages(ctx, r, u, pageSize, maxPages, func(body io.Reader) ([]string, error) {
+		var page catalogPage
+		err := json.NewDecoder(body).Decode(&page)
+		return page.Repositories, err
+	})
+}
+
+// listPages fetches all the pages of a paginated list, like the tag list
+// or the catalog. The `Link` header is followed when the registry provides
+// it, otherwise the `last` parameter is used as long as full pages are
+// returned.
+func listPages(ctx context.Context, r *registry.Registry, first string, pageSize, maxPages int, decode func(body io.Reader) ([]string, error)) ([]string, int, error) {
+	items := []string{}
+	pages := 0
+
+	next, err := url.Parse(first)
+	if err != nil {
+		return []string{}, 0, err
+	}
+	if pageSize > 0 {
+		q := next.Query()
+		q.Set("n", fmt.Sprintf("%d", pageSize))
+		next.RawQuery = q.Encode()
+	}
+
+	for next != nil {
+		if maxPages > 0 && pages >= maxPages {
+			log.WithFields(log.Fields{
+				"url":   first,
+				"pages": pages,
+				"items": len(items),
+			}).Warn("Maximum number of pages reached, the list might be incomplete")
+			break
+		}
+
+		page, header, err := fetchPage(ctx, r, next, decode)
+		if err != nil {
+			return []string{}, pages, err
+		}
+		pages++
+		items = append(items, page...)
+
+		next, err = nextPage(next, header, page, pageSize)
+		if err != nil {
+			return []string{}, pages, err
+		}
+	}
+
+	return items, pages, nil
+}
+
+func fetchPage(ctx context.Context, r *registry.Registry, u *url.URL, decode func(body io.Reader) ([]string, error)) ([]string, http.Header, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return []string{}, nil, err
+	}
+
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return []string{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return []string{}, nil, fmt.Errorf(
+			"%s - Response code: %s - Body %s",
+			u.String(),
+			resp.Status,
+			body)
+	}
+
+	page, err := decode(resp.Body)
+	if err != nil {
+		return []string{}, nil, err
+	}
+
+	return page, resp.Header, nil
+}
+
+// nextPage computes the URL of the page following `current`.
+// A nil URL is returned once the last page has been reached.
+// The `Link` header cannot lead to another host: the credentials
+// of the registry would be sent to it.
+func nextPage(current *url.URL, header http.Header, page []string, pageSize int) (*url.URL, error) {
+	if l, found := link.ParseHeader(header)["next"]; found {
+		next, err := current.Parse(l.URI)
+		if err != nil {
+			return nil, err
+		}
+		if next.Scheme != current.Scheme || next.Host != current.Host {
+			return nil, fmt.Errorf(
+				"The next page of %s is linked to %s, refusing to follow it to another host",
+				current.String(),
+				next.String())
+		}
+		return next, nil
+	}
+
+	// Registries that do not send the `Link` header can still be
+	// paginated using the `last` parameter
+	if pageSize <= 0 || len(page) < pageSize {
+		return nil, nil
+	}
+
+	last := page[len(page)-1]
+	q := current.Query()
+	if q.Get("last") == last {
+		// the registry is ignoring the `last` parameter
+		return nil, nil
+	}
+	q.Set("last", last)
+
+	next := *current
+	next.RawQuery = q.Encode()
+	return &next, nil
+}
+
+// manifestAcceptHeaders lists all the manifest media types understood
+// when resolving a digest. Manifest lists and OCI indexes are accepted,
+// that ensures the digest matches the one reported by `docker pull`
+// for multi-platform images.
+var manifestAcceptHeaders = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// manifestDigest returns the digest of the manifest the registry
+// currently associates with the given reference.
+func manifestDigest(ctx context.Context, r *registry.Registry, repository, ref string) (string, error) {
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", r.URL, repository, ref)
+	r.Logf("registry.manifests.head url=%s", u)
+
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, mediaType := range manifestAcceptHeaders {
+		req.Header.Add("Accept", mediaType)
+	}
+
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s - Response code: %s", u, resp.Status)
+	}
+
+	d := resp.Header.Get("Docker-Content-Digest")
+	if d == "" {
+		return "", fmt.Errorf("%s - the registry did not return the manifest digest", u)
+	}
+
+	return d, nil
+}
+
+// manifest holds the fields shared by manifest lists, OCI indexes and
+// single image manifests
+type manifest struct {
+	MediaType     string `json:"mediaType"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Manifests     []struct {
+		Digest   string   `json:"digest"`
+		Platform Platform `json:"platform"`
+	} `json:"manifests"`
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// imageConfig holds the fields of the image configuration blob
+// that are relevant to the evaluation
+type imageConfig struct {
+	OS           string     `json:"os"`
+	Architecture string     `json:"architecture"`
+	Variant      string     `json:"variant"`
+	Created      *time.Time `json:"created"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// fetchManifest retrieves the manifest associated with the given reference,
+// which is either a manifest list or a single image manifest
+func fetchManifest(ctx context.Context, r *registry.Registry, repository, ref string) (manifest, error) {
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", r.URL, repository, ref)
+	r.Logf("registry.manifests.get url=%s", u)
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return manifest{}, err
+	}
+	for _, mediaType := range manifestAcceptHeaders {
+		req.Header.Add("Accept", mediaType)
+	}
+
+	var m manifest
+	if err = getJSON(ctx, r, req, &m); err != nil {
+		return manifest{}, err
+	}
+
+	if m.SchemaVersion != 2 {
+		return manifest{}, fmt.Errorf("%s - unsupported manifest schema version %d", u, m.SchemaVersion)
+	}
+
+	return m, nil
+}
+
+// fetchImageConfig retrieves the configuration blob of an image
+func fetchImageConfig(ctx context.Context, r *registry.Registry, repository, digest string) (imageConfig, error) {
+	u := fmt.Sprintf("%s/v2/%s/blobs/%s", r.URL, repository, digest)
+	r.Logf("registry.blobs.get url=%s", u)
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return imageConfig{}, err
+	}
+
+	var c imageConfig
+	if err = getJSON(ctx, r, req, &c); err != nil {
+		return imageConfig{}, err
+	}
+
+	return c, nil
+}
+
+func getJSON(ctx context.Context, r *registry.Registry, req *http.Request, response interface{}) error {
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf(
+			"%s - Response code: %s - Body %s",
+			req.URL.String(),
+			resp.Status,
+			body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
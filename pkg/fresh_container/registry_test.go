@@ -0,0 +1,179 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/genuinetools/reg/registry"
+)
+
+func newTestRegistry(srv *httptest.Server) *registry.Registry {
+	return &registry.Registry{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		Logf:   registry.Quiet,
+	}
+}
+
+func TestListTagsLinkHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/app/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Query().Get("last") {
+		case "":
+			// path-absolute reference
+			w.Header().Set("Link", `</v2/app/tags/list?last=1.1.0&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"tags": ["1.0.0", "1.1.0"]}`)
+		case "1.1.0":
+			// absolute URL
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/v2/app/tags/list?last=1.3.0&n=2>; rel="next"`, r.Host))
+			fmt.Fprint(w, `{"tags": ["1.2.0", "1.3.0"]}`)
+		case "1.3.0":
+			fmt.Fprint(w, `{"tags": ["2.0.0"]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	tags, pages, err := listTags(context.Background(), newTestRegistry(srv), "app", 2, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0", "2.0.0"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Unexpected tags %+v", tags)
+	}
+	if pages != 3 {
+		t.Errorf("Unexpected number of pages: %d", pages)
+	}
+
+	// the pages beyond the limit are not fetched
+	tags, pages, err = listTags(context.Background(), newTestRegistry(srv), "app", 2, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tags) != 4 || pages != 2 {
+		t.Errorf("Unexpected result with a page limit: %d pages, tags %+v", pages, tags)
+	}
+}
+
+func TestListTagsLastParameter(t *testing.T) {
+	pages := map[string]string{
+		"":      `{"tags": ["1.0.0", "1.1.0"]}`,
+		"1.1.0": `{"tags": ["1.2.0", "1.3.0"]}`,
+		"1.3.0": `{"tags": []}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no `Link` header is sent
+		fmt.Fprint(w, pages[r.URL.Query().Get("last")])
+	}))
+	defer srv.Close()
+
+	tags, fetched, err := listTags(context.Background(), newTestRegistry(srv), "app", 2, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"}) || fetched != 3 {
+		t.Errorf("Unexpected result: %d pages, tags %+v", fetched, tags)
+	}
+}
+
+type NextPageTestCase struct {
+	Link     string
+	Page     []string
+	PageSize int
+	Expected string
+	Invalid  bool
+}
+
+func TestNextPage(t *testing.T) {
+	current, err := url.Parse("https://registry.test/v2/app/tags/list?n=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []NextPageTestCase{
+		NextPageTestCase{Link: `</v2/app/tags/list?last=b&n=2>; rel="next"`, Expected: "https://registry.test/v2/app/tags/list?last=b&n=2"},
+		NextPageTestCase{Link: `<list?last=b&n=2>; rel="next"`, Expected: "https://registry.test/v2/app/tags/list?last=b&n=2"},
+		NextPageTestCase{Link: `<?last=b&n=2>; rel="next"`, Expected: "https://registry.test/v2/app/tags/list?last=b&n=2"},
+		NextPageTestCase{Link: `<https://registry.test/v2/app/tags/list?last=b>; rel="next"`, Expected: "https://registry.test/v2/app/tags/list?last=b"},
+		// the credentials must not leak to other hosts
+		NextPageTestCase{Link: `<https://mirror.test/v2/app/tags/list?last=b>; rel="next"`, Invalid: true},
+		NextPageTestCase{Link: `<http://registry.test/v2/app/tags/list?last=b>; rel="next"`, Invalid: true},
+		NextPageTestCase{Link: `<https://registry.test:8443/v2/app/tags/list?last=b>; rel="next"`, Invalid: true},
+		NextPageTestCase{Link: `<//mirror.test/v2/app/tags/list?last=b>; rel="next"`, Invalid: true},
+		NextPageTestCase{Link: `</v2/app/tags/list?last=b>; rel="prev"`},
+		// malformed headers are ignored, the `last` parameter is used instead
+		NextPageTestCase{Link: `/v2/app/tags/list?last=b; rel=next`, Page: []string{"a", "b"}, PageSize: 2, Expected: "https://registry.test/v2/app/tags/list?last=b&n=2"},
+		NextPageTestCase{Link: `garbage`, Page: []string{"a"}, PageSize: 2},
+		NextPageTestCase{Link: `<http://[::1>; rel="next"`, Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		header := http.Header{}
+		header.Set("Link", tc.Link)
+
+		u, err := nextPage(current, header, tc.Page, tc.PageSize)
+		if tc.Invalid {
+			if err == nil {
+				t.Errorf("Expected failure for test case %+v, got %v", tc, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for test case %+v: %v", tc, err)
+			continue
+		}
+		if tc.Expected == "" {
+			if u != nil {
+				t.Errorf("Expected no next page for test case %+v, got %s", tc, u)
+			}
+			continue
+		}
+		if u == nil || u.String() != tc.Expected {
+			t.Errorf("Unexpected next page for test case %+v, got %v", tc, u)
+		}
+	}
+}
+
+func TestListTagsInvalidLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<http://[::1>; rel="next"`)
+		fmt.Fprint(w, `{"tags": ["1.0.0"]}`)
+	}))
+	defer srv.Close()
+
+	if _, _, err := listTags(context.Background(), newTestRegistry(srv), "app", 2, 0); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestListTagsForeignLink(t *testing.T) {
+	requests := 0
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"tags": ["2.0.0"]}`)
+	}))
+	defer foreign.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/v2/app/tags/list?last=1.0.0>; rel="next"`, foreign.URL))
+		fmt.Fprint(w, `{"tags": ["1.0.0"]}`)
+	}))
+	defer srv.Close()
+
+	if _, _, err := listTags(context.Background(), newTestRegistry(srv), "app", 1, 0); err == nil {
+		t.Error("Expected an error")
+	}
+	if requests != 0 {
+		t.Errorf("The foreign host received %d requests", requests)
+	}
+}
@@ -0,0 +1,73 @@
+package fresh_container
+
+import (
+	"context"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// HeldBackTag is a tag that satisfies the constraint but has been
+// built too recently to be recommended
+type HeldBackTag struct {
+	Tag        string    `json:"tag"`
+	Created    time.Time `json:"created"`
+	EligibleAt time.Time `json:"eligible_at"`
+}
+
+// MinReleaseAge returns the minimum release age that applies to the
+// evaluation: the one of the request wins over the one set inside of
+// the configuration for the repository or its registry.
+func (image *Image) MinReleaseAge(cfg *config.Config, request ImageUpgradeEvaluationRequest) string {
+	if request.MinReleaseAge != "" || image.local != nil {
+		return request.MinReleaseAge
+	}
+
+	return configOrDefault(cfg).GetMinReleaseAge(image.Domain, image.Path)
+}
+
+// releaseAgeFilter rejects the tags built less than `minAge` before
+// `now`. The rejected tags are appended to `heldBack`. Tags whose
+// creation date is unknown are accepted.
+func (image *Image) releaseAgeFilter(ctx context.Context, minAge time.Duration, platform *Platform, now time.Time, heldBack *[]HeldBackTag) candidateFilter {
+	return func(r *registry.Registry, location registries.Location, tag string, current bool) (bool, error) {
+		if current {
+			return true, nil
+		}
+
+		created, err := creationTime(ctx, r, location.Path, tag, platform)
+		if err != nil {
+			return false, err
+		}
+		if created == nil {
+			log.WithFields(log.Fields{
+				"image": image.FullNameWithoutTag(),
+				"tag":   tag,
+			}).Debug("The creation date of the tag is unknown, ignoring the minimum release age")
+			return true, nil
+		}
+
+		if isOlderThan(*created, minAge, now) {
+			return true, nil
+		}
+
+		held := HeldBackTag{
+			Tag:        tag,
+			Created:    *created,
+			EligibleAt: created.Add(minAge),
+		}
+		log.WithFields(log.Fields{
+			"image":       image.FullNameWithoutTag(),
+			"tag":         tag,
+			"created":     held.Created.Format(time.RFC3339),
+			"eligible_at": held.EligibleAt.Format(time.RFC3339),
+		}).Debug("Holding back tag that has been released too recently")
+		*heldBack = append(*heldBack, held)
+		image.explanation.record(tag, false, "built on %s, held back until %s", held.Created.Format(time.RFC3339), held.EligibleAt.Format(time.RFC3339))
+
+		return false, nil
+	}
+}
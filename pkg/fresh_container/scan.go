@@ -0,0 +1,223 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// PolicyViolation describes why a repository has been reported by
+// a registry scan
+type PolicyViolation string
+
+const (
+	// None of the tags of the repository follows semantic versioning
+	ViolationNoSemverTag PolicyViolation = "no-semver-tag"
+	// The newest tag of the repository has been built longer than
+	// the maximum age ago
+	ViolationMaxAge PolicyViolation = "max-age"
+)
+
+// RegistryScanRequest holds the parameters of a registry scan
+type RegistryScanRequest struct {
+	Registry string
+	// Glob patterns, see `path.Match`, selecting the repositories to scan.
+	// All the repositories are scanned when none is given
+	Include []string
+	// Glob patterns of the repositories that are not scanned
+	Exclude   []string
+	TagPrefix string
+	// Coerce tags like `v1.2.3` into versions, see `ParseTag`
+	Loose bool
+	// Version scheme followed by the tags, see `VersionSchemes`. The
+	// one set inside of the configuration for each repository is used
+	// when empty, semver otherwise.
+	Scheme string
+	// Repositories whose newest tag has been built longer than this ago
+	// break the policy. Expressed like `180d`, see `ParseAge`
+	MaxAge string
+}
+
+// RepositoryScanResult holds the outcome of the scan of a repository
+type RepositoryScanResult struct {
+	Repository    string            `json:"repository"`
+	LatestTag     string            `json:"latest_tag,omitempty"`
+	LatestCreated *time.Time        `json:"latest_created,omitempty"`
+	Violations    []PolicyViolation `json:"violations,omitempty"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// RegistryScanReport lists the repositories that have been scanned
+type RegistryScanReport struct {
+	Registry     string                 `json:"registry"`
+	MaxAge       string                 `json:"max_age,omitempty"`
+	Repositories []RepositoryScanResult `json:"repositories"`
+}
+
+// Violating returns the repositories breaking the policy
+func (report *RegistryScanReport) Violating() []RepositoryScanResult {
+	violating := []RepositoryScanResult{}
+	for _, result := range report.Repositories {
+		if len(result.Violations) > 0 {
+			violating = append(violating, result)
+		}
+	}
+	return violating
+}
+
+// Failed returns the repositories that could not be scanned
+func (report *RegistryScanReport) Failed() []RepositoryScanResult {
+	failed := []RepositoryScanResult{}
+	for _, result := range report.Repositories {
+		if result.Error != "" {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Selects returns true when the repository matches the include and
+// exclude patterns of the request
+func (request *RegistryScanRequest) Selects(repository string) bool {
+	for _, pattern := range request.Exclude {
+		if matched, _ := path.Match(pattern, repository); matched {
+			return false
+		}
+	}
+	if len(request.Include) == 0 {
+		return true
+	}
+	for _, pattern := range request.Include {
+		if matched, _ := path.Match(pattern, repository); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the patterns and the maximum age of the request
+func (request *RegistryScanRequest) Validate() error {
+	for _, pattern := range append(append([]string{}, request.Include...), request.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pattern %s: %v", pattern, err)
+		}
+	}
+	if request.MaxAge != "" {
+		if _, err := ParseAge(request.MaxAge); err != nil {
+			return err
+		}
+	}
+	if _, err := NewVersionScheme(request.Scheme, request.Loose); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ScanRegistry enumerates the repositories of the registry using its
+// catalog and looks for the highest semver tag of each one of them.
+// The repositories that cannot be scanned are part of the report,
+// together with the error that occurred.
+func ScanRegistry(ctx context.Context, cfg *config.Config, request RegistryScanRequest) (RegistryScanReport, error) {
+	if err := request.Validate(); err != nil {
+		return RegistryScanReport{}, err
+	}
+	cfg = configOrDefault(cfg)
+	var maxAge time.Duration
+	if request.MaxAge != "" {
+		maxAge, _ = ParseAge(request.MaxAge)
+	}
+
+	r, err := createRegistryClient(ctx, registries.Location{Domain: request.Registry}, cfg)
+	if err != nil {
+		return RegistryScanReport{}, err
+	}
+
+	rc := cfg.GetRegistryConfig(request.Registry)
+	repositories, pages, err := listRepositories(ctx, r, rc.TagsPageSize, rc.TagsMaxPages)
+	if err != nil {
+		return RegistryScanReport{}, err
+	}
+	sort.Strings(repositories)
+
+	log.WithFields(log.Fields{
+		"registry":     request.Registry,
+		"pages":        pages,
+		"repositories": len(repositories),
+	}).Debug("Fetched registry catalog")
+
+	report := RegistryScanReport{
+		Registry:     request.Registry,
+		MaxAge:       request.MaxAge,
+		Repositories: []RepositoryScanResult{},
+	}
+	now := time.Now()
+	for _, repository := range repositories {
+		if !request.Selects(repository) {
+			continue
+		}
+
+		result, err := scanRepository(ctx, r, cfg, rc, request, repository, maxAge, now)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"registry":   request.Registry,
+				"repository": repository,
+				"error_kind": ErrorKindOf(err),
+			}).WithError(err).Warn("Cannot scan repository")
+			result.Error = err.Error()
+		}
+		report.Repositories = append(report.Repositories, result)
+	}
+
+	return report, nil
+}
+
+func scanRepository(ctx context.Context, r *registry.Registry, cfg *config.Config, rc config.RegistryConfig, request RegistryScanRequest, repository string, maxAge time.Duration, now time.Time) (RepositoryScanResult, error) {
+	result := RepositoryScanResult{Repository: repository}
+
+	scheme, err := resolveScheme(cfg, request.Scheme, request.Loose, request.Registry, repository)
+	if err != nil {
+		return result, err
+	}
+
+	tags, _, err := listTags(ctx, r, repository, rc.TagsPageSize, rc.TagsMaxPages)
+	if err != nil {
+		return result, err
+	}
+
+	exclude, err := ParseTagExclusions(cfg.GetExclude(request.Registry, repository))
+	if err != nil {
+		return result, err
+	}
+
+	versions, names, err := tagsToVersions(tags, tagMatcher{prefix: request.TagPrefix, scheme: scheme, exclude: exclude}, true, nil)
+	if err != nil {
+		return result, err
+	}
+	if len(versions) == 0 {
+		result.Violations = append(result.Violations, ViolationNoSemverTag)
+		return result, nil
+	}
+	sortVersions(scheme, versions)
+	result.LatestTag = request.TagPrefix + names[versions[len(versions)-1].String()]
+
+	if maxAge == 0 {
+		return result, nil
+	}
+
+	result.LatestCreated, err = creationTime(ctx, r, repository, result.LatestTag, nil)
+	if err != nil {
+		return result, err
+	}
+	if result.LatestCreated != nil && isOlderThan(*result.LatestCreated, maxAge, now) {
+		result.Violations = append(result.Violations, ViolationMaxAge)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+type SelectsTestCase struct {
+	Include    []string
+	Exclude    []string
+	Repository string
+	Expected   bool
+}
+
+func TestRegistryScanRequestSelects(t *testing.T) {
+	testCases := []SelectsTestCase{
+		SelectsTestCase{Repository: "team/app", Expected: true},
+		SelectsTestCase{Include: []string{"team/*"}, Repository: "team/app", Expected: true},
+		SelectsTestCase{Include: []string{"team/*"}, Repository: "team/sub/app", Expected: false},
+		SelectsTestCase{Include: []string{"team/*"}, Repository: "other/app", Expected: false},
+		SelectsTestCase{Include: []string{"team/*"}, Exclude: []string{"team/tmp-*"}, Repository: "team/tmp-app", Expected: false},
+		SelectsTestCase{Exclude: []string{"*"}, Repository: "app", Expected: false},
+	}
+
+	for _, tc := range testCases {
+		request := RegistryScanRequest{Include: tc.Include, Exclude: tc.Exclude}
+		if selected := request.Selects(tc.Repository); selected != tc.Expected {
+			t.Errorf("Unexpected result for test case %+v, got %v", tc, selected)
+		}
+	}
+}
+
+func TestScanRegistry(t *testing.T) {
+	now := time.Now().UTC()
+	created := map[string]time.Time{
+		"team/app": now.Add(-24 * time.Hour),
+		"team/old": now.Add(-400 * 24 * time.Hour),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/_catalog":
+			// the pages are linked using the `Link` header
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/_catalog?last=team%2Fnotags&n=3>; rel="next"`)
+				fmt.Fprint(w, `{"repositories": ["team/app", "team/broken", "team/notags"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"repositories": ["team/old", "team/tmp-app", "other/app"]}`)
+		case strings.HasSuffix(r.URL.Path, "/tags/list"):
+			switch strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/tags/list") {
+			case "team/app", "team/old":
+				fmt.Fprint(w, `{"tags": ["1.0.0", "1.10.0", "1.9.0", "latest"]}`)
+			case "team/notags":
+				fmt.Fprint(w, `{"tags": ["latest"]}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case strings.HasSuffix(r.URL.Path, "/manifests/1.10.0"):
+			repository := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/1.10.0")
+			fmt.Fprintf(w, `{"schemaVersion": 2, "config": {"digest": "sha256:%s"}}`, strings.Replace(repository, "/", "-", -1))
+		case strings.Contains(r.URL.Path, "/blobs/sha256:"):
+			repository := r.URL.Path[strings.LastIndex(r.URL.Path, ":")+1:]
+			fmt.Fprintf(w, `{"created": "%s"}`, created[strings.Replace(repository, "-", "/", -1)].Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	host, rc := newTestRegistryConfig(srv)
+	rc.MaxRetries = -1
+	cfg := config.NewConfig()
+	cfg.Registries = map[string]config.RegistryConfig{host: rc}
+
+	report, err := ScanRegistry(context.Background(), &cfg, RegistryScanRequest{
+		Registry: host,
+		Include:  []string{"team/*"},
+		Exclude:  []string{"team/tmp-*"},
+		MaxAge:   "1y",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	repositories := []string{}
+	for _, result := range report.Repositories {
+		repositories = append(repositories, result.Repository)
+	}
+	expected := []string{"team/app", "team/broken", "team/notags", "team/old"}
+	if !reflect.DeepEqual(repositories, expected) {
+		t.Fatalf("Unexpected repositories %+v", repositories)
+	}
+
+	app, broken, notags, old := report.Repositories[0], report.Repositories[1], report.Repositories[2], report.Repositories[3]
+	if app.LatestTag != "1.10.0" || app.LatestCreated == nil || len(app.Violations) != 0 {
+		t.Errorf("Unexpected result %+v", app)
+	}
+	if broken.Error == "" {
+		t.Errorf("Expected an error for %+v", broken)
+	}
+	if !reflect.DeepEqual(notags.Violations, []PolicyViolation{ViolationNoSemverTag}) {
+		t.Errorf("Unexpected result %+v", notags)
+	}
+	if !reflect.DeepEqual(old.Violations, []PolicyViolation{ViolationMaxAge}) {
+		t.Errorf("Unexpected result %+v", old)
+	}
+
+	if len(report.Violating()) != 2 || len(report.Failed()) != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,333 @@
+package fresh_container
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+// Names of the version schemes
+const (
+	SchemeSemver  = "semver"
+	SchemeCalver  = "calver"
+	SchemeNumeric = "numeric"
+	SchemeDate    = "date"
+)
+
+var (
+	VersionSchemes = []string{SchemeSemver, SchemeCalver, SchemeNumeric, SchemeDate}
+
+	calverRegexp  = regexp.MustCompile(`^(\d{2}|\d{4})\.(\d{1,2})(?:\.(\d{1,2}))?(?:-([0-9A-Za-z.-]+))?$`)
+	numericRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)*)(?:-([0-9A-Za-z.-]+))?$`)
+	dateRegexp    = regexp.MustCompile(`^(\d{4})-?(\d{2})-?(\d{2})(?:[-T._]?(\d{2})(\d{2})(\d{2})?)?(?:-([0-9A-Za-z.-]+))?$`)
+)
+
+// VersionScheme describes how the tags of an image are turned into
+// versions, how these versions are ordered and how the constraints
+// are evaluated.
+// All the schemes represent their versions using `semver.Version`:
+// the components that do not fit into major, minor and patch are
+// stored inside of the build metadata, which is why the versions must
+// be compared using the scheme.
+type VersionScheme interface {
+	Name() string
+	// Parse converts the tag, once the prefix has been removed,
+	// into a version
+	Parse(tag string) (semver.Version, error)
+	// Compare returns -1, 0 or 1 when v1 is respectively lower than,
+	// equal to or greater than v2
+	Compare(v1, v2 semver.Version) int
+	// ParseConstraint converts the constraint into a range, the
+	// versions it references follow the scheme
+	ParseConstraint(constraint string) (semver.Range, error)
+	// Format returns the canonical tag of the version
+	Format(v semver.Version) string
+}
+
+// NewVersionScheme returns the scheme with the given name, semver is
+// used when the name is empty. The loose mode affects only semver, see
+// `coerceVersion`.
+func NewVersionScheme(name string, loose bool) (VersionScheme, error) {
+	switch name {
+	case "", SchemeSemver:
+		return SemverScheme{Loose: loose}, nil
+	case SchemeCalver:
+		return CalverScheme{}, nil
+	case SchemeNumeric:
+		return NumericScheme{}, nil
+	case SchemeDate:
+		return DateScheme{}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown version scheme %s. Valid ones are %+v", name, VersionSchemes)
+}
+
+// resolveScheme returns the scheme with the given name, falling back
+// to the one set inside of the configuration for the repository
+func resolveScheme(cfg *config.Config, name string, loose bool, domain, repository string) (VersionScheme, error) {
+	if name == "" {
+		name = cfg.GetScheme(domain, repository)
+	}
+
+	return NewVersionScheme(name, loose || cfg.LooseVersions)
+}
+
+// sortVersions sorts the versions in increasing order
+func sortVersions(scheme VersionScheme, versions semver.Versions) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return scheme.Compare(versions[i], versions[j]) < 0
+	})
+}
+
+// SemverScheme handles the tags following semantic versioning,
+// constraints use the npm syntax, see `ParseConstraint`
+type SemverScheme struct {
+	// Coerce tags like `v1.2` into versions
+	Loose bool
+}
+
+func (s SemverScheme) Name() string {
+	return SchemeSemver
+}
+
+func (s SemverScheme) Parse(tag string) (semver.Version, error) {
+	return parseVersion(tag, s.Loose)
+}
+
+func (s SemverScheme) Compare(v1, v2 semver.Version) int {
+	return v1.Compare(v2)
+}
+
+func (s SemverScheme) ParseConstraint(constraint string) (semver.Range, error) {
+	return ParseConstraint(constraint)
+}
+
+func (s SemverScheme) Format(v semver.Version) string {
+	return v.String()
+}
+
+// CalverScheme handles calendar versions like `2024.01`, `2024.01.15`
+// or `22.04`. A suffix, like `2024.01-alpine`, is handled as a
+// pre-release.
+type CalverScheme struct{}
+
+func (s CalverScheme) Name() string {
+	return SchemeCalver
+}
+
+func (s CalverScheme) Parse(tag string) (semver.Version, error) {
+	match := calverRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return semver.Version{}, fmt.Errorf("Invalid calendar version %s: must be expressed as YYYY.MM[.DD]", tag)
+	}
+
+	parts := []uint64{}
+	for _, part := range match[1:4] {
+		if part == "" {
+			continue
+		}
+		n, _ := strconv.ParseUint(part, 10, 64)
+		parts = append(parts, n)
+	}
+	if parts[1] < 1 || parts[1] > 12 || (len(parts) == 3 && (parts[2] < 1 || parts[2] > 31)) {
+		return semver.Version{}, fmt.Errorf("Invalid calendar version %s: wrong month or day", tag)
+	}
+
+	return numericVersion(parts, match[4])
+}
+
+func (s CalverScheme) Compare(v1, v2 semver.Version) int {
+	return compareNumeric(v1, v2)
+}
+
+func (s CalverScheme) ParseConstraint(constraint string) (semver.Range, error) {
+	return parseConstraint(s, constraint)
+}
+
+func (s CalverScheme) Format(v semver.Version) string {
+	tag := fmt.Sprintf("%d.%02d", v.Major, v.Minor)
+	if v.Patch > 0 {
+		tag = fmt.Sprintf("%s.%02d", tag, v.Patch)
+	}
+	return tag + formatPre(v)
+}
+
+// NumericScheme handles versions made of any number of numeric
+// components, like `1.2.3.4`. Missing components count as zero.
+// A suffix, like `1.2.3.4-alpine`, is handled as a pre-release.
+type NumericScheme struct{}
+
+func (s NumericScheme) Name() string {
+	return SchemeNumeric
+}
+
+func (s NumericScheme) Parse(tag string) (semver.Version, error) {
+	match := numericRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return semver.Version{}, fmt.Errorf("Invalid numeric version %s: must be made of numbers separated by dots", tag)
+	}
+
+	parts := []uint64{}
+	for _, part := range strings.Split(match[1], ".") {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semver.Version{}, fmt.Errorf("Invalid numeric version %s: %v", tag, err)
+		}
+		parts = append(parts, n)
+	}
+
+	return numericVersion(parts, match[2])
+}
+
+func (s NumericScheme) Compare(v1, v2 semver.Version) int {
+	return compareNumeric(v1, v2)
+}
+
+func (s NumericScheme) ParseConstraint(constraint string) (semver.Range, error) {
+	return parseConstraint(s, constraint)
+}
+
+func (s NumericScheme) Format(v semver.Version) string {
+	parts := []string{}
+	for _, n := range numericParts(v) {
+		parts = append(parts, strconv.FormatUint(n, 10))
+	}
+	return strings.Join(parts, ".") + formatPre(v)
+}
+
+// DateScheme handles date stamps like `20240115` or `2024-01-15`,
+// optionally followed by the time, e.g. `20240115-103000`.
+// A suffix, like `20240115-alpine`, is handled as a pre-release.
+type DateScheme struct{}
+
+func (s DateScheme) Name() string {
+	return SchemeDate
+}
+
+func (s DateScheme) Parse(tag string) (semver.Version, error) {
+	match := dateRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return semver.Version{}, fmt.Errorf("Invalid date stamp %s: must be expressed as YYYYMMDD[-HHMM[SS]]", tag)
+	}
+
+	stamp := fmt.Sprintf("%s%s%s%s%s", match[1], match[2], match[3], match[4], match[5])
+	seconds := match[6]
+	if match[4] == "" {
+		stamp += "0000"
+	}
+	if seconds == "" {
+		seconds = "00"
+	}
+	date, err := time.Parse("200601021504", stamp)
+	if err != nil || seconds > "59" {
+		return semver.Version{}, fmt.Errorf("Invalid date stamp %s: wrong date or time", tag)
+	}
+
+	parts := []uint64{uint64(date.Year()), uint64(date.Month()), uint64(date.Day())}
+	if match[4] != "" {
+		clock, _ := strconv.ParseUint(date.Format("1504")+seconds, 10, 64)
+		parts = append(parts, clock)
+	}
+
+	return numericVersion(parts, match[7])
+}
+
+func (s DateScheme) Compare(v1, v2 semver.Version) int {
+	return compareNumeric(v1, v2)
+}
+
+func (s DateScheme) ParseConstraint(constraint string) (semver.Range, error) {
+	return parseConstraint(s, constraint)
+}
+
+func (s DateScheme) Format(v semver.Version) string {
+	tag := fmt.Sprintf("%04d%02d%02d", v.Major, v.Minor, v.Patch)
+	if parts := numericParts(v); len(parts) > 3 {
+		tag = fmt.Sprintf("%s-%06d", tag, parts[3])
+	}
+	return tag + formatPre(v)
+}
+
+// numericVersion stores the numeric components into the version: the
+// first three are the major, minor and patch ones, the others are
+// stored inside of the build metadata
+func numericVersion(parts []uint64, pre string) (semver.Version, error) {
+	v := partsVersion(parts)
+	if pre != "" {
+		for _, p := range strings.Split(pre, ".") {
+			prVersion, err := semver.NewPRVersion(p)
+			if err != nil {
+				return semver.Version{}, err
+			}
+			v.Pre = append(v.Pre, prVersion)
+		}
+	}
+
+	return v, nil
+}
+
+// numericParts returns all the numeric components of the version
+// partsVersion returns the version made of the numeric components,
+// missing ones count as zero
+func partsVersion(parts []uint64) semver.Version {
+	parts = append([]uint64{}, parts...)
+	for len(parts) < 3 {
+		parts = append(parts, 0)
+	}
+
+	v := semver.Version{Major: parts[0], Minor: parts[1], Patch: parts[2]}
+	for _, n := range parts[3:] {
+		v.Build = append(v.Build, strconv.FormatUint(n, 10))
+	}
+	return v
+}
+
+func numericParts(v semver.Version) []uint64 {
+	parts := []uint64{v.Major, v.Minor, v.Patch}
+	for _, b := range v.Build {
+		n, _ := strconv.ParseUint(b, 10, 64)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// compareNumeric compares all the numeric components of the versions,
+// then their pre-releases following the semver rules
+func compareNumeric(v1, v2 semver.Version) int {
+	p1, p2 := numericParts(v1), numericParts(v2)
+	for i := 0; i < len(p1) || i < len(p2); i++ {
+		var n1, n2 uint64
+		if i < len(p1) {
+			n1 = p1[i]
+		}
+		if i < len(p2) {
+			n2 = p2[i]
+		}
+		if n1 != n2 {
+			if n1 < n2 {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return semver.Version{Pre: v1.Pre}.Compare(semver.Version{Pre: v2.Pre})
+}
+
+func formatPre(v semver.Version) string {
+	if len(v.Pre) == 0 {
+		return ""
+	}
+
+	pre := []string{}
+	for _, p := range v.Pre {
+		pre = append(pre, p.String())
+	}
+	return "-" + strings.Join(pre, ".")
+}
@@ -0,0 +1,210 @@
+package fresh_container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+type SchemeParseTestCase struct {
+	Scheme   string
+	Tag      string
+	Expected string
+	Invalid  bool
+}
+
+func TestVersionSchemeParse(t *testing.T) {
+	testCases := []SchemeParseTestCase{
+		SchemeParseTestCase{Scheme: SchemeSemver, Tag: "1.2.3-alpine", Expected: "1.2.3-alpine"},
+		SchemeParseTestCase{Scheme: SchemeSemver, Tag: "1.2", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "2024.01", Expected: "2024.01"},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "2024.1.15", Expected: "2024.01.15"},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "22.04", Expected: "22.04"},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "2024.01-alpine", Expected: "2024.01-alpine"},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "2024.13", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "2024", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeCalver, Tag: "1.2.3.4", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeNumeric, Tag: "1.2.3.4", Expected: "1.2.3.4"},
+		SchemeParseTestCase{Scheme: SchemeNumeric, Tag: "7", Expected: "7.0.0"},
+		SchemeParseTestCase{Scheme: SchemeNumeric, Tag: "1.02.3.4.5-rc1", Expected: "1.2.3.4.5-rc1"},
+		SchemeParseTestCase{Scheme: SchemeNumeric, Tag: "1.2.x", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "20240115", Expected: "20240115"},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "2024-01-15", Expected: "20240115"},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "20240115-1030", Expected: "20240115-103000"},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "20240115T103015", Expected: "20240115-103015"},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "20240115-alpine", Expected: "20240115-alpine"},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "20240230", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "20240115-2500", Invalid: true},
+		SchemeParseTestCase{Scheme: SchemeDate, Tag: "2024.01.15", Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		scheme, err := NewVersionScheme(tc.Scheme, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		version, err := scheme.Parse(tc.Tag)
+		if tc.Invalid {
+			if err == nil {
+				t.Errorf("Expected failure parsing test case %+v, got %s", tc, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if formatted := scheme.Format(version); formatted != tc.Expected {
+			t.Errorf("Unexpected version for test case %+v, got %s", tc, formatted)
+		}
+	}
+}
+
+func TestNewVersionSchemeUnknown(t *testing.T) {
+	if _, err := NewVersionScheme("romver", false); err == nil {
+		t.Error("Expected failure creating an unknown scheme")
+	}
+}
+
+type SchemeNextVersionTestCase struct {
+	Scheme      string
+	CurTag      string
+	Constraint  string
+	Tags        []string
+	ExpectedTag string
+}
+
+func TestVersionSchemeNextVersion(t *testing.T) {
+	testCases := []SchemeNextVersionTestCase{
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeCalver,
+			CurTag:      "22.04",
+			Constraint:  ">= 22.04 < 24.10",
+			Tags:        []string{"20.04", "22.04", "22.10", "23.04", "24.04", "24.10", "latest"},
+			ExpectedTag: "24.04",
+		},
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeCalver,
+			CurTag:      "2024.01.15",
+			Constraint:  "< 2024.03 || > 2025.01",
+			Tags:        []string{"2024.01.15", "2024.02.01", "2024.12.01", "2025.02.01"},
+			ExpectedTag: "2025.02.01",
+		},
+		SchemeNextVersionTestCase{
+			// components are compared as numbers
+			Scheme:      SchemeNumeric,
+			CurTag:      "1.2.3.4",
+			Constraint:  ">=1.2.3.4 <1.2.4 !=1.2.3.10",
+			Tags:        []string{"1.2.3.4", "1.2.3.9", "1.2.3.10", "1.2.3.11-rc1", "1.2.4.0"},
+			ExpectedTag: "1.2.3.9",
+		},
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeDate,
+			CurTag:      "20240115",
+			Constraint:  "< 20240301",
+			Tags:        []string{"20231231", "2024-01-15", "20240201", "20240201-1200", "20240301"},
+			ExpectedTag: "20240201-1200",
+		},
+		// all the schemes share the grammar of the semver constraints
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeCalver,
+			CurTag:      "2024.01",
+			Constraint:  "^2024.01",
+			Tags:        []string{"2024.01", "2024.11", "2025.01"},
+			ExpectedTag: "2024.11",
+		},
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeCalver,
+			CurTag:      "2024.01.15",
+			Constraint:  "~2024.01.15",
+			Tags:        []string{"2024.01.15", "2024.01.30", "2024.02.01"},
+			ExpectedTag: "2024.01.30",
+		},
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeCalver,
+			CurTag:      "22.04",
+			Constraint:  "(22.x || 23.*) != 22.10",
+			Tags:        []string{"22.04", "22.10", "23.04", "24.04"},
+			ExpectedTag: "23.04",
+		},
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeNumeric,
+			CurTag:      "1.2.3.4",
+			Constraint:  "~1.2.3.4, != 1.2.9.x",
+			Tags:        []string{"1.2.3.4", "1.2.8.1", "1.2.9.0", "1.2.9.5", "1.3.0.0"},
+			ExpectedTag: "1.2.8.1",
+		},
+		SchemeNextVersionTestCase{
+			Scheme:      SchemeDate,
+			CurTag:      "20240115",
+			Constraint:  "2024-01-15 - 2024-02-01",
+			Tags:        []string{"20240115", "20240201", "20240201-1200", "20240301"},
+			ExpectedTag: "20240201",
+		},
+	}
+
+	for _, tc := range testCases {
+		cfg := config.NewConfig()
+		image, err := NewImageFromRequest(ImageUpgradeEvaluationRequest{
+			Image:  "registry.local.lan/team/app:" + tc.CurTag,
+			Scheme: tc.Scheme,
+		}, &cfg)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if err = image.SetTagVersions(tc.Tags, true); err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		evaluation, err := image.EvalUpgrade(tc.Constraint)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if evaluation.NextVersion != tc.ExpectedTag {
+			t.Errorf("Unexpected next version for test case %+v, got %s", tc, evaluation.NextVersion)
+		}
+	}
+}
+
+func TestVersionSchemeFromConfig(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Repositories = map[string]config.RepositoryConfig{
+		"registry.local.lan/team/app": config.RepositoryConfig{Scheme: SchemeCalver},
+	}
+
+	image, err := NewImageFromRequest(ImageUpgradeEvaluationRequest{Image: "registry.local.lan/team/app:2024.01"}, &cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if image.Scheme.Name() != SchemeCalver {
+		t.Errorf("Unexpected scheme %s", image.Scheme.Name())
+	}
+
+	if err = image.FetchTagsFrom(context.Background(), staticTagSource{"2023.12", "2024.01", "2024.02", "latest"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = image.EvalUpgrade(">= 1.0.0"); err == nil {
+		t.Error("Expected failure parsing a semver constraint")
+	}
+
+	evaluation, err := image.EvalUpgrade(">= 2024.01")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !evaluation.Stale || evaluation.NextVersion != "2024.02" {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+
+	// the request takes precedence over the configuration
+	if _, err = NewImageFromRequest(ImageUpgradeEvaluationRequest{
+		Image:  "registry.local.lan/team/app:2024.01",
+		Scheme: SchemeSemver,
+	}, &cfg); err == nil {
+		t.Error("Expected failure parsing a calendar version using semver")
+	}
+}
@@ -0,0 +1,99 @@
+package fresh_container
+
+import (
+	"fmt"
+
+	"github.com/blang/semver"
+)
+
+// UpgradeStrategy tells which one of the versions satisfying the
+// constraint is recommended
+type UpgradeStrategy string
+
+const (
+	// The highest version
+	StrategyLatest UpgradeStrategy = "latest"
+	// The lowest version greater than the current one
+	StrategyNearest UpgradeStrategy = "nearest"
+	// The highest patch release of the lowest minor version greater
+	// than the current one. The highest patch release of the current
+	// minor version when there is none.
+	StrategyNextMinorLatestPatch UpgradeStrategy = "next-minor-latest-patch"
+)
+
+var UpgradeStrategies = []UpgradeStrategy{StrategyLatest, StrategyNearest, StrategyNextMinorLatestPatch}
+
+// ParseUpgradeStrategy returns the strategy with the given name, the
+// latest one when the name is empty
+func ParseUpgradeStrategy(strategy string) (UpgradeStrategy, error) {
+	if strategy == "" {
+		return StrategyLatest, nil
+	}
+	for _, s := range UpgradeStrategies {
+		if string(s) == strategy {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown upgrade strategy %s. Valid ones are %+v", strategy, UpgradeStrategies)
+}
+
+func (s UpgradeStrategy) name() string {
+	if s == "" {
+		return string(StrategyLatest)
+	}
+	return string(s)
+}
+
+// pick returns the recommended version among the candidates, which are
+// all greater than the current version
+func (s UpgradeStrategy) pick(scheme VersionScheme, curVer semver.Version, candidates semver.Versions) semver.Version {
+	switch s {
+	case StrategyNearest:
+		nearest := candidates[0]
+		for _, v := range candidates {
+			if compareFlavored(scheme, v, nearest) < 0 {
+				nearest = v
+			}
+		}
+		return nearest
+	case StrategyNextMinorLatestPatch:
+		var series *semver.Version
+		for _, v := range candidates {
+			if sameMinor(v, curVer) {
+				continue
+			}
+			if series == nil || compareMinor(v, *series) < 0 {
+				v := v
+				series = &v
+			}
+		}
+		if series == nil {
+			series = &curVer
+		}
+
+		var latest *semver.Version
+		for _, v := range candidates {
+			if sameMinor(v, *series) && (latest == nil || compareFlavored(scheme, v, *latest) > 0) {
+				v := v
+				latest = &v
+			}
+		}
+		return *latest
+	}
+
+	latest := candidates[0]
+	for _, v := range candidates {
+		if compareFlavored(scheme, v, latest) >= 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+func sameMinor(v1, v2 semver.Version) bool {
+	return v1.Major == v2.Major && v1.Minor == v2.Minor
+}
+
+func compareMinor(v1, v2 semver.Version) int {
+	return semver.Version{Major: v1.Major, Minor: v1.Minor}.Compare(semver.Version{Major: v2.Major, Minor: v2.Minor})
+}
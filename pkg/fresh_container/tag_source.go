@@ -0,0 +1,50 @@
+package fresh_container
+
+import (
+	"context"
+
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/registries"
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+// TagSource provides the tags of images
+type TagSource interface {
+	// Tags returns all the tags of the repository of the image
+	Tags(ctx context.Context, image *Image) ([]string, error)
+}
+
+// RegistryTagSource fetches the tags from the registry holding the
+// image, or from its mirrors. All the pages of the tag list are
+// fetched, up to the limit set inside of the registry configuration.
+// It is the default source used by `Image.FetchTags`. The default
+// configuration is used when `Config` is nil.
+type RegistryTagSource struct {
+	Config *config.Config
+}
+
+func (s *RegistryTagSource) Tags(ctx context.Context, image *Image) ([]string, error) {
+	cfg := configOrDefault(s.Config)
+
+	var tags []string
+	var pages int
+	err := image.withRegistry(ctx, cfg, func(r *registry.Registry, location registries.Location) error {
+		var err error
+		rc := cfg.GetRegistryConfig(location.Domain)
+		tags, pages, err = listTags(ctx, r, location.Path, rc.TagsPageSize, rc.TagsMaxPages)
+		return err
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"image":    image.FullNameWithoutTag(),
+		"location": image.location.String(),
+		"pages":    pages,
+		"tags":     len(tags),
+	}).Debug("Fetched image tags")
+
+	return tags, nil
+}
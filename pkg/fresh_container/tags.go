@@ -1,11 +1,16 @@
 package fresh_container
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/blang/semver"
 	log "github.com/sirupsen/logrus"
-	"strings"
 )
 
+var tagPatternGroups = []string{"major", "minor", "patch", "pre", "variant"}
+
 //func ImageTags(ctx context.Context, cfg *config.Config, image Image) ([]string, error) {
 //  // Create the registry client.
 //  r, err := createRegistryClient(ctx, image.Domain, cfg)
@@ -23,23 +28,236 @@ import (
 //}
 
 func TagsToVersions(tags []string, tagPrefix string, skipInvalid bool) (versions semver.Versions, err error) {
+	versions, _, err = tagsToVersions(tags, tagMatcher{prefix: tagPrefix, scheme: SemverScheme{}}, skipInvalid, nil)
+	return versions, err
+}
+
+// tagMatcher selects the tags holding a version and parses them
+type tagMatcher struct {
+	prefix  string
+	pattern *TagPattern
+	// Variant of the current tag, the tags of other variants are ignored
+	variant string
+	scheme  VersionScheme
+	// Tags that are ignored even if they hold a valid version
+	exclude TagExclusions
+}
+
+// parse returns the version held by the tag, `ok` is false when the
+// tag has to be ignored because it does not match the prefix, the
+// pattern or the variant
+func (m tagMatcher) parse(tag string) (v semver.Version, variant string, ok bool, err error) {
+	if m.prefix != "" && !strings.HasPrefix(tag, m.prefix) {
+		return semver.Version{}, "", false, nil
+	}
+	version := strings.TrimPrefix(tag, m.prefix)
+
+	if m.pattern != nil {
+		match, found := m.pattern.Match(version)
+		if !found {
+			return semver.Version{}, "", false, nil
+		}
+		version = match.Version
+		variant = match.Variant
+		if _, isSemver := m.scheme.(SemverScheme); isSemver {
+			// the pattern tells the components apart, the missing
+			// ones can be added
+			version = coerceVersion(version)
+		}
+	}
+
+	v, err = m.scheme.Parse(version)
+	return v, variant, true, err
+}
+
+// tagsToVersions converts the tags into versions, it also returns the
+// name of the tag, without the prefix, each version has been parsed from.
+// The excluded tags are ignored, see `TagExclusions`.
+// When multiple tags are parsed into the same version, the canonical
+// one wins, e.g. `1.2.0` over `v1.2`.
+// The reasons why tags are ignored are recorded into the explanation.
+func tagsToVersions(tags []string, matcher tagMatcher, skipInvalid bool, e *explanation) (semver.Versions, map[string]string, error) {
+	versions := semver.Versions{}
+	names := map[string]string{}
+
 	for _, tag := range tags {
-		if tagPrefix == "" || strings.HasPrefix(tag, tagPrefix) { // only consider tags that have the specified prefix
-			tag = strings.TrimPrefix(tag, tagPrefix)
-			v, err := semver.Parse(tag)
-			if err == nil {
-				versions = append(versions, v)
-			} else if skipInvalid {
-				log.WithFields(log.Fields{
-					"tag":       tag,
-					"tagPrefix": tagPrefix,
-					"error":     err}).Warn("Skipping image tag")
+		v, variant, ok, err := matcher.parse(tag)
+		if !ok {
+			// only consider tags that have the specified prefix and pattern
+			if matcher.prefix != "" && !strings.HasPrefix(tag, matcher.prefix) {
+				e.record(tag, false, "does not start with the tag prefix %s", matcher.prefix)
 			} else {
-				return semver.Versions{}, err
+				e.record(tag, false, "does not match the tag pattern %s", matcher.pattern)
 			}
+			continue
+		}
+		if variant != matcher.variant {
+			e.record(tag, false, "variant '%s' differs from the '%s' one of the current tag", variant, matcher.variant)
+			continue
 		}
+		fullTag := tag
+		tag = strings.TrimPrefix(tag, matcher.prefix)
+
+		if err != nil {
+			e.record(fullTag, false, "invalid version: %v", err)
+			if !skipInvalid {
+				return semver.Versions{}, map[string]string{}, err
+			}
+			log.WithFields(log.Fields{
+				"tag":       tag,
+				"tagPrefix": matcher.prefix,
+				"error":     err}).Warn("Skipping image tag")
+			continue
+		}
+
+		if entry, excluded := matcher.exclude.Excludes(matcher.scheme, tag, v); excluded {
+			e.record(fullTag, false, "excluded by %s", entry)
+			log.WithFields(log.Fields{
+				"tag":       tag,
+				"tagPrefix": matcher.prefix,
+				"exclusion": entry}).Debug("Skipping excluded image tag")
+			continue
+		}
+
+		name, found := names[v.String()]
+		if !found {
+			versions = append(versions, v)
+		}
+		if !found || (name != matcher.scheme.Format(v) && tag == matcher.scheme.Format(v)) {
+			if found {
+				e.record(matcher.prefix+name, false, "same version as the %s tag", fullTag)
+			}
+			names[v.String()] = tag
+			e.record(fullTag, true, "valid version")
+			e.setVersionTag(v, fullTag)
+		} else {
+			e.record(fullTag, false, "same version as the %s tag", matcher.prefix+name)
+		}
+	}
+
+	return versions, names, nil
+}
+
+// TagPattern extracts the version out of tags using a regular expression
+// with named groups: `major`, which is required, `minor`, `patch`, `pre`
+// and `variant`. The expression must match the whole tag, e.g.
+// `(?P<major>\d+)\.(?P<minor>\d+)\.(?P<patch>\d+)-(?P<variant>alpine.*)`.
+type TagPattern struct {
+	expr   string
+	regexp *regexp.Regexp
+}
+
+// TagPatternMatch holds the parts of a tag matched by a pattern
+type TagPatternMatch struct {
+	// Components of the version, joined by dots, followed by `-pre`
+	Version string
+	Variant string
+}
+
+// ParseTagPattern compiles the pattern, see `TagPattern`
+func ParseTagPattern(expr string) (*TagPattern, error) {
+	re, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid tag pattern %s: %v", expr, err)
 	}
-	return versions, nil
+
+	hasMajor := false
+	for _, name := range re.SubexpNames() {
+		switch name {
+		case "major":
+			hasMajor = true
+		case "", "minor", "patch", "pre", "variant":
+		default:
+			return nil, fmt.Errorf("Invalid tag pattern %s: unknown group %s. Valid ones are %+v", expr, name, tagPatternGroups)
+		}
+	}
+	if !hasMajor {
+		return nil, fmt.Errorf("Invalid tag pattern %s: the major group is required", expr)
+	}
+
+	return &TagPattern{expr: expr, regexp: re}, nil
+}
+
+// Match returns the parts of the tag captured by the pattern, `ok` is
+// false when the tag does not match it
+func (p *TagPattern) Match(tag string) (match TagPatternMatch, ok bool) {
+	submatches := p.regexp.FindStringSubmatch(tag)
+	if submatches == nil {
+		return TagPatternMatch{}, false
+	}
+
+	groups := map[string]string{}
+	for i, name := range p.regexp.SubexpNames() {
+		if name != "" {
+			groups[name] = submatches[i]
+		}
+	}
+
+	components := []string{groups["major"]}
+	for _, name := range []string{"minor", "patch"} {
+		if groups[name] != "" {
+			components = append(components, groups[name])
+		}
+	}
+	match.Version = strings.Join(components, ".")
+	if groups["pre"] != "" {
+		match.Version += "-" + groups["pre"]
+	}
+	match.Variant = groups["variant"]
+
+	return match, true
+}
+
+func (p *TagPattern) String() string {
+	return p.expr
+}
+
+// ParseTag parses the tag, once the prefix has been removed, into
+// a semver version. See `coerceVersion` for the effects of the loose
+// mode and `VersionScheme` for the other kinds of versions.
+func ParseTag(tag, tagPrefix string, loose bool) (semver.Version, error) {
+	return SemverScheme{Loose: loose}.Parse(strings.TrimPrefix(tag, tagPrefix))
+}
+
+func parseVersion(version string, loose bool) (semver.Version, error) {
+	if loose {
+		version = coerceVersion(version)
+	}
+	return semver.Parse(version)
+}
+
+// coerceVersion turns versions like `v1.2.3`, `1.21` or `3` into valid
+// semver ones: the leading `v` is stripped, the missing minor and patch
+// components are added and leading zeros are removed, e.g. `v1.02-alpine`
+// becomes `1.2.0-alpine`.
+// Versions that cannot be coerced are returned as they are.
+func coerceVersion(version string) string {
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+
+	core, suffix := version, ""
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		core, suffix = version[:i], version[i:]
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return version
+	}
+	for i, part := range parts {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return version
+		}
+		if trimmed := strings.TrimLeft(part, "0"); trimmed != "" {
+			parts[i] = trimmed
+		} else {
+			parts[i] = "0"
+		}
+	}
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+
+	return strings.Join(parts, ".") + suffix
 }
 
 //func ImageTag(img string) (semver.Version, error) {
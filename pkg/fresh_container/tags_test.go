@@ -0,0 +1,133 @@
+package fresh_container
+
+import (
+	"reflect"
+	"testing"
+)
+
+type ParseTagTestCase struct {
+	Tag       string
+	TagPrefix string
+	Loose     bool
+	Expected  string
+	Invalid   bool
+}
+
+func TestParseTag(t *testing.T) {
+	testCases := []ParseTagTestCase{
+		ParseTagTestCase{Tag: "1.2.3", Expected: "1.2.3"},
+		ParseTagTestCase{Tag: "v1.2.3", Invalid: true},
+		ParseTagTestCase{Tag: "1.21", Invalid: true},
+		ParseTagTestCase{Tag: "1.2.3", Loose: true, Expected: "1.2.3"},
+		ParseTagTestCase{Tag: "v1.2.3", Loose: true, Expected: "1.2.3"},
+		ParseTagTestCase{Tag: "V1.2.3", Loose: true, Expected: "1.2.3"},
+		ParseTagTestCase{Tag: "1.21", Loose: true, Expected: "1.21.0"},
+		ParseTagTestCase{Tag: "3", Loose: true, Expected: "3.0.0"},
+		ParseTagTestCase{Tag: "v1.02-alpine", Loose: true, Expected: "1.2.0-alpine"},
+		ParseTagTestCase{Tag: "1.2+build.1", Loose: true, Expected: "1.2.0+build.1"},
+		ParseTagTestCase{Tag: "Ubuntu-v20.04", TagPrefix: "Ubuntu-", Loose: true, Expected: "20.4.0"},
+		ParseTagTestCase{Tag: "1.2.3.4", Loose: true, Invalid: true},
+		ParseTagTestCase{Tag: "latest", Loose: true, Invalid: true},
+		ParseTagTestCase{Tag: "v", Loose: true, Invalid: true},
+		ParseTagTestCase{Tag: "1..2", Loose: true, Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		version, err := ParseTag(tc.Tag, tc.TagPrefix, tc.Loose)
+		if tc.Invalid {
+			if err == nil {
+				t.Errorf("Expected failure parsing test case %+v, got %s", tc, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+		if version.String() != tc.Expected {
+			t.Errorf("Unexpected version for test case %+v, got %s", tc, version)
+		}
+	}
+}
+
+func TestTagsToVersionsLoose(t *testing.T) {
+	versions, names, err := tagsToVersions(
+		[]string{"v1.2", "1.2.0", "v1.3", "1.4", "v1.4", "latest"},
+		tagMatcher{scheme: SemverScheme{Loose: true}},
+		true,
+		nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(versions) != 3 {
+		t.Errorf("Unexpected versions %+v", versions)
+	}
+	// the tag following semver wins, otherwise the first one is kept
+	expected := map[string]string{"1.2.0": "1.2.0", "1.3.0": "v1.3", "1.4.0": "1.4"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Unexpected tag names %+v", names)
+	}
+}
+
+type TagPatternTestCase struct {
+	Pattern         string
+	Tag             string
+	ExpectedVersion string
+	ExpectedVariant string
+	NoMatch         bool
+}
+
+func TestTagPatternMatch(t *testing.T) {
+	testCases := []TagPatternTestCase{
+		TagPatternTestCase{
+			Pattern:         `(?P<major>\d+)\.(?P<minor>\d+)\.(?P<patch>\d+)-(?P<variant>alpine[\d.]+)`,
+			Tag:             "1.5.6-alpine3.18",
+			ExpectedVersion: "1.5.6",
+			ExpectedVariant: "alpine3.18",
+		},
+		TagPatternTestCase{
+			Pattern:         `release-(?P<major>\d+)\.(?P<minor>\d+)\.(?P<patch>\d+)(?:-(?P<pre>rc\d+))?-(?P<variant>amd64|arm64)`,
+			Tag:             "release-1.2.3-rc1-arm64",
+			ExpectedVersion: "1.2.3-rc1",
+			ExpectedVariant: "arm64",
+		},
+		TagPatternTestCase{
+			Pattern:         `(?P<variant>jdk\d+)-(?P<major>\d+)(?:\.(?P<minor>\d+))?-slim`,
+			Tag:             "jdk17-1-slim",
+			ExpectedVersion: "1",
+			ExpectedVariant: "jdk17",
+		},
+		TagPatternTestCase{
+			// the whole tag must match
+			Pattern: `(?P<major>\d+)\.(?P<minor>\d+)`,
+			Tag:     "1.2-slim",
+			NoMatch: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		pattern, err := ParseTagPattern(tc.Pattern)
+		if err != nil {
+			t.Errorf("Unexpected error when handling test case %+v: %+v", tc, err)
+			continue
+		}
+
+		match, ok := pattern.Match(tc.Tag)
+		if ok == tc.NoMatch {
+			t.Errorf("Unexpected match result for test case %+v, got %v", tc, ok)
+			continue
+		}
+		if match.Version != tc.ExpectedVersion || match.Variant != tc.ExpectedVariant {
+			t.Errorf("Unexpected match for test case %+v, got %+v", tc, match)
+		}
+	}
+}
+
+func TestParseTagPatternInvalid(t *testing.T) {
+	for _, expr := range []string{`(?P<minor>\d+)`, `(?P<major>\d+)-(?P<flavor>\w+)`, `(?P<major>\d+`} {
+		if _, err := ParseTagPattern(expr); err == nil {
+			t.Errorf("Expected failure parsing the %s pattern", expr)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package fresh_container
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Lifetime of the tokens that do not specify it, as mandated by
+	// the docker token authentication specification
+	defaultTokenLifetime = 60 * time.Second
+	// Tokens are refreshed slightly before their expiration, to not
+	// have them expire while the request is in flight
+	tokenExpiryLeeway = 5 * time.Second
+	// Client ID sent to the OAuth2 token endpoints
+	tokenClientID = "fresh-container"
+)
+
+var (
+	challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	repositoryPathRegexp = regexp.MustCompile(`^/v2/(.+)/(tags|manifests|blobs)/`)
+)
+
+// challenge is a `WWW-Authenticate: Bearer` challenge returned by
+// a registry
+type challenge struct {
+	Realm   string
+	Service string
+	Scope   string
+}
+
+// bearerToken is a token obtained from the realm of a challenge
+type bearerToken struct {
+	challenge challenge
+	token     string
+	expiresAt time.Time
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	IssuedAt     string `json:"issued_at"`
+}
+
+// tokenStore holds the tokens obtained for each repository of a
+// registry, together with the identity token once rotated by the realm
+type tokenStore struct {
+	mu            sync.Mutex
+	identityToken string
+	tokens        map[string]*bearerToken
+}
+
+type tokenStoreKey struct {
+	registry      string
+	username      string
+	password      string
+	identityToken string
+}
+
+// The token stores are shared by all the registry clients using the
+// same credentials: tokens, and rotated identity tokens, outlive the
+// client that obtained them
+var tokenStores = struct {
+	sync.Mutex
+	byKey map[tokenStoreKey]*tokenStore
+}{
+	byKey: make(map[tokenStoreKey]*tokenStore),
+}
+
+// tokenStoreFor returns the token store of the registry for the
+// given credentials
+func tokenStoreFor(registry, username, password, identityToken string) *tokenStore {
+	tokenStores.Lock()
+	defer tokenStores.Unlock()
+
+	key := tokenStoreKey{
+		registry:      registry,
+		username:      username,
+		password:      password,
+		identityToken: identityToken,
+	}
+	store, found := tokenStores.byKey[key]
+	if !found {
+		store = newTokenStore(identityToken)
+		tokenStores.byKey[key] = store
+	}
+
+	return store
+}
+
+func newTokenStore(identityToken string) *tokenStore {
+	return &tokenStore{
+		identityToken: identityToken,
+		tokens:        map[string]*bearerToken{},
+	}
+}
+
+// tokenTransport implements the docker token authentication. Tokens are
+// obtained from the realm of the `WWW-Authenticate` challenges using
+// either the username and password or the identity token of the store,
+// which is exchanged following the OAuth2 refresh token flow. The tokens
+// are cached by the store for each repository and refreshed once they
+// expire. When a registry token is provided it is sent as it is.
+type tokenTransport struct {
+	next          http.RoundTripper
+	store         *tokenStore
+	username      string
+	password      string
+	registryToken string
+
+	now func() time.Time
+}
+
+func newTokenTransport(next http.RoundTripper, store *tokenStore, username, password, registryToken string) *tokenTransport {
+	return &tokenTransport{
+		next:          next,
+		store:         store,
+		username:      username,
+		password:      password,
+		registryToken: registryToken,
+		now:           time.Now,
+	}
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.registryToken != "" {
+		return t.next.RoundTrip(withBearer(req, t.registryToken))
+	}
+
+	key := tokenCacheKey(req.URL)
+	token, err := t.cachedToken(req, key)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req = withBearer(req, token)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	ch, found := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !found {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	token, authResp, err := t.fetchToken(req, key, ch)
+	if err != nil || authResp != nil {
+		return authResp, err
+	}
+
+	return t.next.RoundTrip(withBearer(req, token))
+}
+
+// cachedToken returns the token previously obtained for the repository
+// targeted by the request, refreshing it when it is expired. An empty
+// string is returned when no token is known.
+func (t *tokenTransport) cachedToken(req *http.Request, key string) (string, error) {
+	t.store.mu.Lock()
+	cached, found := t.store.tokens[key]
+	t.store.mu.Unlock()
+
+	if !found {
+		return "", nil
+	}
+	if t.now().Add(tokenExpiryLeeway).Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	log.WithFields(log.Fields{
+		"realm": cached.challenge.Realm,
+		"scope": cached.challenge.Scope,
+	}).Debug("Refreshing expired registry token")
+
+	token, authResp, err := t.fetchToken(req, key, cached.challenge)
+	if err != nil {
+		return "", err
+	}
+	if authResp != nil {
+		// let the registry issue a new challenge
+		authResp.Body.Close()
+		return "", nil
+	}
+	return token, nil
+}
+
+// fetchToken obtains a new token from the realm of the challenge. The
+// response of the realm is returned when the token cannot be issued.
+func (t *tokenTransport) fetchToken(req *http.Request, key string, ch challenge) (string, *http.Response, error) {
+	t.store.mu.Lock()
+	identityToken := t.store.identityToken
+	t.store.mu.Unlock()
+
+	authReq, err := ch.tokenRequest(t.username, t.password, identityToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resp, err := t.next.RoundTrip(authReq.WithContext(req.Context()))
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", resp, nil
+	}
+	defer resp.Body.Close()
+
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", nil, fmt.Errorf("Cannot decode the token returned by %s: %v", ch.Realm, err)
+	}
+
+	token := tr.Token
+	if token == "" {
+		token = tr.AccessToken
+	}
+	if token == "" {
+		return "", nil, fmt.Errorf("Empty token returned by %s", ch.Realm)
+	}
+
+	issuedAt := t.now()
+	if tr.IssuedAt != "" {
+		if parsed, err := time.Parse(time.RFC3339, tr.IssuedAt); err == nil {
+			issuedAt = parsed
+		}
+	}
+	lifetime := defaultTokenLifetime
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	t.store.tokens[key] = &bearerToken{
+		challenge: ch,
+		token:     token,
+		expiresAt: issuedAt.Add(lifetime),
+	}
+	if tr.RefreshToken != "" && identityToken != "" {
+		// the realm rotated the refresh token
+		t.store.identityToken = tr.RefreshToken
+	}
+
+	return token, nil, nil
+}
+
+// tokenRequest builds the request sent to the realm: the identity token
+// is exchanged using the OAuth2 refresh token flow, otherwise the token
+// is requested using basic authentication
+func (ch challenge) tokenRequest(username, password, identityToken string) (*http.Request, error) {
+	realm, err := url.Parse(ch.Realm)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid realm %s: %v", ch.Realm, err)
+	}
+
+	if identityToken != "" {
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", identityToken)
+		form.Set("client_id", tokenClientID)
+		form.Set("service", ch.Service)
+		if ch.Scope != "" {
+			form.Set("scope", ch.Scope)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, realm.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+
+	q := realm.Query()
+	q.Set("service", ch.Service)
+	for _, scope := range strings.Fields(ch.Scope) {
+		q.Add("scope", scope)
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	return req, nil
+}
+
+// parseChallenge parses a `WWW-Authenticate` header, returning false
+// when it is not a bearer challenge
+func parseChallenge(header string) (challenge, bool) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return challenge{}, false
+	}
+
+	ch := challenge{}
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(parts[1], -1) {
+		switch strings.ToLower(match[1]) {
+		case "realm":
+			ch.Realm = match[2]
+		case "service":
+			ch.Service = match[2]
+		case "scope":
+			ch.Scope = match[2]
+		}
+	}
+
+	return ch, ch.Realm != ""
+}
+
+// tokenCacheKey returns the repository targeted by the request, tokens
+// are scoped to a repository. The other endpoints share the same key.
+func tokenCacheKey(u *url.URL) string {
+	if match := repositoryPathRegexp.FindStringSubmatch(u.Path); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
@@ -0,0 +1,248 @@
+package fresh_container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flavio/fresh-container/pkg/registrytest"
+)
+
+// newTokenServer returns a registry protecting its repositories with
+// tokens issued by its `/token` realm. Tokens are valid for 5 minutes.
+func newTokenServer(requests map[string]int) *httptest.Server {
+	issued := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			issued++
+			switch {
+			case r.Method == http.MethodPost:
+				r.ParseForm()
+				requests["refresh "+r.PostForm.Get("refresh_token")]++
+				if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("scope") != "repository:app:pull" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			default:
+				username, password, _ := r.BasicAuth()
+				requests["basic "+username+":"+password]++
+				if password != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+			}
+			fmt.Fprintf(w, `{"access_token": "token-%d", "refresh_token": "refresh-%d", "expires_in": 300}`, issued, issued)
+			return
+		}
+
+		requests[r.Header.Get("Authorization")]++
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", issued) && r.Header.Get("Authorization") != "Bearer static" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="registry.local.lan",scope="repository:app:pull"`,
+				srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	return srv
+}
+
+func TestTokenTransportBasic(t *testing.T) {
+	requests := map[string]int{}
+	srv := newTokenServer(requests)
+	defer srv.Close()
+
+	transport := newTokenTransport(http.DefaultTransport, newTokenStore(""), "user", "secret", "")
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL + "/v2/app/tags/list")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Unexpected status %s", resp.Status)
+		}
+	}
+
+	// the token is cached
+	if requests["basic user:secret"] != 1 || requests["Bearer token-1"] != 3 {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+
+	transport = newTokenTransport(http.DefaultTransport, newTokenStore(""), "user", "wrong", "")
+	client = &http.Client{Transport: transport}
+	resp, err := client.Get(srv.URL + "/v2/app/tags/list")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Unexpected status %s", resp.Status)
+	}
+}
+
+func TestTokenTransportIdentityToken(t *testing.T) {
+	requests := map[string]int{}
+	srv := newTokenServer(requests)
+	defer srv.Close()
+
+	now := time.Now()
+	transport := newTokenTransport(http.DefaultTransport, newTokenStore("refresh-0"), "", "", "")
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	get := func() {
+		resp, err := client.Get(srv.URL + "/v2/app/manifests/latest")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Unexpected status %s", resp.Status)
+		}
+	}
+
+	get()
+	get()
+	if requests["refresh refresh-0"] != 1 || requests["Bearer token-1"] != 2 {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+
+	// the token expired: the rotated refresh token is used to obtain a new one
+	now = now.Add(10 * time.Minute)
+	get()
+	if requests["refresh refresh-1"] != 1 || requests["Bearer token-2"] != 1 {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+}
+
+func TestTokenTransportRegistryToken(t *testing.T) {
+	requests := map[string]int{}
+	srv := newTokenServer(requests)
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTokenTransport(http.DefaultTransport, newTokenStore(""), "user", "secret", "static")}
+	resp, err := client.Get(srv.URL + "/v2/app/tags/list")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(requests) != 1 || requests["Bearer static"] != 1 {
+		t.Errorf("Unexpected status %s, requests %+v", resp.Status, requests)
+	}
+}
+
+func TestTokenStoreSharedAcrossClients(t *testing.T) {
+	requests := map[string]int{}
+	srv := newTokenServer(requests)
+	defer srv.Close()
+
+	now := time.Now()
+	get := func() {
+		// each check creates its own client
+		transport := newTokenTransport(http.DefaultTransport, tokenStoreFor(srv.URL, "", "", "refresh-0"), "", "", "")
+		transport.now = func() time.Time { return now }
+		resp, err := (&http.Client{Transport: transport}).Get(srv.URL + "/v2/app/manifests/latest")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Unexpected status %s", resp.Status)
+		}
+	}
+
+	get()
+	get()
+	if requests["refresh refresh-0"] != 1 || requests["Bearer token-1"] != 2 {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+
+	// the refresh token rotated by the first client is used by the next ones
+	now = now.Add(10 * time.Minute)
+	get()
+	now = now.Add(10 * time.Minute)
+	get()
+	if requests["refresh refresh-0"] != 1 || requests["refresh refresh-1"] != 1 || requests["refresh refresh-2"] != 1 {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+
+	// other credentials do not share the tokens
+	if tokenStoreFor(srv.URL, "", "", "refresh-0") == tokenStoreFor(srv.URL, "user", "secret", "") {
+		t.Error("Unexpected token store shared by different credentials")
+	}
+}
+
+func TestFetchTagsReusesToken(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.RequireAuth("user", "secret")
+	reg.AddTags("team/app", "1.0.0", "1.1.0")
+
+	cfg := reg.Config()
+	rc := cfg.Registries[reg.Host()]
+	rc.Username = "user"
+	rc.Password = "secret"
+	cfg.Registries[reg.Host()] = rc
+
+	for i := 0; i < 2; i++ {
+		image, err := NewImage(reg.Host()+"/team/app:1.0.0", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = image.FetchTags(context.Background(), cfg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(image.TagVersions) != 2 {
+			t.Errorf("Unexpected tags %+v", image.TagVersions)
+		}
+	}
+
+	// the tokens obtained by the first lookup are reused by the second one
+	if requests := reg.Requests("/token"); requests != 2 {
+		t.Errorf("Unexpected number of token requests %d", requests)
+	}
+}
+
+type ChallengeTestCase struct {
+	Header   string
+	Expected challenge
+	Found    bool
+}
+
+func TestParseChallenge(t *testing.T) {
+	testCases := []ChallengeTestCase{
+		ChallengeTestCase{
+			Header: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`,
+			Expected: challenge{
+				Realm:   "https://auth.docker.io/token",
+				Service: "registry.docker.io",
+				Scope:   "repository:library/nginx:pull,push",
+			},
+			Found: true,
+		},
+		ChallengeTestCase{
+			Header:   `Basic realm="registry"`,
+			Expected: challenge{},
+			Found:    false,
+		},
+		ChallengeTestCase{
+			Header:   ``,
+			Expected: challenge{},
+			Found:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		ch, found := parseChallenge(tc.Header)
+		if ch != tc.Expected || found != tc.Found {
+			t.Errorf("Unexpected challenge for test case %+v, got %+v", tc, ch)
+		}
+	}
+}
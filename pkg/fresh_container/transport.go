@@ -0,0 +1,252 @@
+package fresh_container
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/flavio/fresh-container/internal/config"
+	"github.com/flavio/fresh-container/internal/ratelimit"
+	"github.com/genuinetools/reg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+var protocolRegexp = regexp.MustCompile("^https?://")
+
+// newRegistry creates a registry client the same way `registry.New` does,
+// but its chain of transports adds timeouts and retries to each request,
+// throttles them using the rate limit of the registry, stops contacting
+// failing registries and classifies the errors.
+// A nil tlsConfig means the default TLS settings are used.
+func newRegistry(ctx context.Context, auth types.AuthConfig, domain string, rc config.RegistryConfig, tlsConfig *tls.Config) (*registry.Registry, error) {
+	address := domain
+	if address == "" || address == "docker.io" {
+		address = auth.ServerAddress
+	}
+	url := withProtocol(address, rc.NonSSL)
+	authURL := withProtocol(auth.ServerAddress, rc.NonSSL)
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if tlsConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsConfig
+		transport = t
+	}
+
+	transport = &retryTransport{
+		next:       transport,
+		timeout:    rc.TimeoutDuration(),
+		maxRetries: rc.MaxRetries,
+		backoff:    rc.BackoffDuration(),
+		maxBackoff: rc.MaxBackoffDuration(),
+	}
+	transport = newTokenTransport(
+		transport,
+		tokenStoreFor(domain, auth.Username, auth.Password, auth.IdentityToken),
+		auth.Username,
+		auth.Password,
+		auth.RegistryToken)
+	transport = &registry.BasicTransport{
+		Transport: transport,
+		URL:       authURL,
+		Username:  auth.Username,
+		Password:  auth.Password,
+	}
+	transport = ratelimit.Default.Transport(domain, transport)
+	transport = &registryTransport{
+		registry: domain,
+		breaker:  circuitBreakerFor(domain, rc.CircuitBreakerThreshold, rc.CircuitBreakerCooldownDuration()),
+		next:     transport,
+	}
+
+	r := &registry.Registry{
+		URL:    url,
+		Domain: protocolRegexp.ReplaceAllString(url, ""),
+		Client: &http.Client{
+			Transport: transport,
+		},
+		Username: auth.Username,
+		Password: auth.Password,
+		Logf:     registry.Quiet,
+		Opt: registry.Opt{
+			Domain:   domain,
+			Insecure: tlsConfig != nil && tlsConfig.InsecureSkipVerify,
+			SkipPing: rc.SkipPing,
+			NonSSL:   rc.NonSSL,
+		},
+	}
+
+	if r.Pingable() && !rc.SkipPing {
+		if err := r.Ping(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func withProtocol(address string, nonSSL bool) string {
+	if protocolRegexp.MatchString(address) {
+		return address
+	}
+	if nonSSL {
+		return "http://" + address
+	}
+	return "https://" + address
+}
+
+// retryTransport bounds the duration of each attempt of a request and
+// retries the idempotent ones failing because of network errors or
+// server side errors, using an exponential backoff
+type retryTransport struct {
+	next       http.RoundTripper
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+
+		retry := idempotent && attempt < t.maxRetries && req.Context().Err() == nil
+		if err == nil {
+			retry = retry && resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+		}
+		if !retry {
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		delay := t.delay(attempt)
+		log.WithFields(log.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt + 1,
+			"reason":  reason,
+			"delay":   delay.String(),
+		}).Debug("Retrying registry request")
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// attempt sends the request once, the timeout covers the
+// reading of the response body too
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// delay returns the time to wait before the given retry
+func (t *retryTransport) delay(attempt int) time.Duration {
+	delay := t.backoff
+	for i := 0; i < attempt && delay < t.maxBackoff; i++ {
+		delay *= 2
+	}
+	if t.maxBackoff > 0 && delay > t.maxBackoff {
+		delay = t.maxBackoff
+	}
+	return delay
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// registryTransport turns failed requests into `*RegistryError` and
+// feeds the circuit breaker of the registry
+type registryTransport struct {
+	registry string
+	breaker  *circuitBreaker
+	next     http.RoundTripper
+}
+
+func (t *registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if allowed, until := t.breaker.allow(); !allowed {
+		return nil, &RegistryError{
+			Registry: t.registry,
+			Kind:     ErrorKindUnreachable,
+			Err: fmt.Errorf(
+				"too many consecutive failures, the registry is not contacted until %s",
+				until.Format(time.RFC3339)),
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		var limited *ratelimit.Error
+		if errors.As(err, &limited) {
+			return nil, &RegistryError{Registry: t.registry, Kind: ErrorKindRateLimited, Err: err}
+		}
+		if req.Context().Err() != nil {
+			// the caller gave up, that is not a failure of the registry
+			return nil, err
+		}
+
+		t.breaker.failure()
+		return nil, &RegistryError{Registry: t.registry, Kind: ErrorKindUnreachable, Err: err}
+	}
+
+	if resp.StatusCode >= 500 {
+		t.breaker.failure()
+	} else {
+		t.breaker.success()
+	}
+
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, &RegistryError{
+		Registry: t.registry,
+		Kind:     errorKindOfStatus(resp.StatusCode),
+		Err: fmt.Errorf(
+			"%s %s - Response code: %s - Body %s",
+			req.Method,
+			req.URL.String(),
+			resp.Status,
+			body),
+	}
+}
@@ -0,0 +1,159 @@
+package fresh_container
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+func newTestRegistryConfig(srv *httptest.Server) (string, config.RegistryConfig) {
+	host := strings.TrimPrefix(srv.URL, "http://")
+	cfg := config.NewConfig()
+	cfg.Registries = map[string]config.RegistryConfig{
+		host: config.RegistryConfig{
+			NonSSL:                  true,
+			SkipPing:                true,
+			AuthDomain:              srv.URL,
+			MaxRetries:              2,
+			Backoff:                 "1ms",
+			MaxBackoff:              "2ms",
+			CircuitBreakerThreshold: 3,
+		},
+	}
+	return host, cfg.GetRegistryConfig(host)
+}
+
+type TransportTestCase struct {
+	Path         string
+	ExpectedKind ErrorKind
+	Requests     int
+}
+
+func TestRegistryTransport(t *testing.T) {
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flaky") && requests[r.URL.Path] < 3:
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasPrefix(r.URL.Path, "/missing"):
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasPrefix(r.URL.Path, "/denied"):
+			w.WriteHeader(http.StatusForbidden)
+		case strings.HasPrefix(r.URL.Path, "/broken"):
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	host, rc := newTestRegistryConfig(srv)
+	r, err := newRegistry(context.Background(), types.AuthConfig{ServerAddress: srv.URL}, host, rc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []TransportTestCase{
+		// recovers at the third attempt
+		TransportTestCase{Path: "/flaky", ExpectedKind: "", Requests: 3},
+		TransportTestCase{Path: "/missing", ExpectedKind: ErrorKindNotFound, Requests: 1},
+		TransportTestCase{Path: "/denied", ExpectedKind: ErrorKindAuth, Requests: 1},
+		TransportTestCase{Path: "/broken", ExpectedKind: ErrorKindUnreachable, Requests: 3},
+	}
+
+	for _, tc := range testCases {
+		resp, err := r.Client.Get(srv.URL + tc.Path)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		if kind := ErrorKindOf(err); kind != tc.ExpectedKind {
+			t.Errorf("Unexpected error kind for test case %+v, got %q: %v", tc, kind, err)
+		}
+		if requests[tc.Path] != tc.Requests {
+			t.Errorf("Unexpected number of requests for test case %+v, got %d", tc, requests[tc.Path])
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	host, rc := newTestRegistryConfig(srv)
+	rc.MaxRetries = -1
+	r, err := newRegistry(context.Background(), types.AuthConfig{ServerAddress: srv.URL}, host, rc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err = r.Client.Get(srv.URL + "/v2/"); ErrorKindOf(err) != ErrorKindUnreachable {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	// the circuit opened after 3 failures
+	if requests != 3 {
+		t.Errorf("Unexpected number of requests: %d", requests)
+	}
+}
+
+func TestDisabledRetriesAndCircuitBreaker(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	cfg := config.NewConfig()
+	cfg.Registries = map[string]config.RegistryConfig{
+		host: config.RegistryConfig{
+			NonSSL:                  true,
+			SkipPing:                true,
+			Timeout:                 "0s",
+			MaxRetries:              -1,
+			CircuitBreakerThreshold: -1,
+		},
+	}
+	rc := cfg.GetRegistryConfig(host)
+	if rc.TimeoutDuration() != 0 || rc.MaxRetries != -1 || rc.CircuitBreakerThreshold != -1 {
+		t.Fatalf("Unexpected registry configuration %+v", rc)
+	}
+
+	r, err := newRegistry(context.Background(), types.AuthConfig{ServerAddress: srv.URL}, host, rc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err = r.Client.Get(srv.URL + "/v2/"); ErrorKindOf(err) != ErrorKindUnreachable {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	// each request is sent once, and the registry is always contacted
+	if requests != 10 {
+		t.Errorf("Unexpected number of requests: %d", requests)
+	}
+
+	// zero means the default values
+	cfg.Registries[host] = config.RegistryConfig{}
+	rc = cfg.GetRegistryConfig(host)
+	if rc.TimeoutDuration() != 30*time.Second ||
+		rc.MaxRetries != config.DEFAULT_REGISTRY_MAX_RETRIES ||
+		rc.CircuitBreakerThreshold != config.DEFAULT_CIRCUIT_BREAKER_THRESHOLD {
+		t.Errorf("Unexpected registry configuration %+v", rc)
+	}
+}
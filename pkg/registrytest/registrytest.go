@@ -0,0 +1,449 @@
+// Package registrytest provides an in-process container registry, speaking
+// the OCI distribution protocol, that can be used to test the evaluation
+// of images without reaching the network.
+//
+//	reg := registrytest.New()
+//	defer reg.Close()
+//	reg.AddTags("team/app", "1.0.0", "1.1.0")
+//
+//	cfg := reg.Config()
+//	image, err := fresh_container.NewImage(reg.Host()+"/team/app:1.0.0", "")
+//	err = image.FetchTags(ctx, cfg)
+package registrytest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flavio/fresh-container/internal/config"
+)
+
+const (
+	MediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeImageConfig  = "application/vnd.docker.container.image.v1+json"
+
+	// Platform of the images that do not specify it
+	DefaultPlatform = "linux/amd64"
+)
+
+var repositoryPathRegexp = regexp.MustCompile(`^/v2/(.+)/(tags/list|manifests/[^/]+|blobs/[^/]+)$`)
+
+// Image describes an image published by a tag
+type Image struct {
+	// Expressed as `os/arch[/variant]`, `DefaultPlatform` when empty
+	Platform string
+	// Build date of the image, omitted from the image configuration
+	// when not set
+	Created time.Time
+	Labels  map[string]string
+}
+
+// Failure describes the response returned instead of the regular one
+type Failure struct {
+	StatusCode int
+	Header     http.Header
+	// Number of requests failing, a negative value means all of them
+	Times int
+}
+
+type content struct {
+	mediaType string
+	data      []byte
+}
+
+// Registry is a container registry served by an `httptest.Server`
+type Registry struct {
+	Server *httptest.Server
+
+	mu sync.Mutex
+	// repository -> tag -> manifest digest
+	tags map[string]map[string]string
+	// digest -> manifest or blob
+	contents map[string]content
+	// path prefix -> failure
+	failures map[string]*Failure
+	// method and path of the requests received
+	requests []string
+	username string
+	password string
+	tokens   map[string]bool
+}
+
+// New starts a new empty registry, it must be closed once done
+func New() *Registry {
+	r := &Registry{
+		tags:     map[string]map[string]string{},
+		contents: map[string]content{},
+		failures: map[string]*Failure{},
+		requests: []string{},
+		tokens:   map[string]bool{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	return r
+}
+
+// Close shuts down the registry
+func (r *Registry) Close() {
+	r.Server.Close()
+}
+
+// Host returns the `host:port` of the registry, to be used as the
+// domain of the image references
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.Server.URL, "http://")
+}
+
+// Config returns a configuration reaching the registry: plain HTTP is
+// used and failed requests are retried without waiting. It can be given
+// to the functions of the fresh_container package, which also accept
+// the ones created by other registries.
+func (r *Registry) Config() *config.Config {
+	cfg := config.NewConfig()
+	cfg.Registries = map[string]config.RegistryConfig{
+		r.Host(): config.RegistryConfig{
+			AuthDomain: r.Server.URL,
+			NonSSL:     true,
+			Backoff:    "1ms",
+			MaxBackoff: "1ms",
+		},
+	}
+	return &cfg
+}
+
+// AddTags publishes the given tags inside of the repository, each one
+// of them references a `DefaultPlatform` image
+func (r *Registry) AddTags(repository string, tags ...string) {
+	for _, tag := range tags {
+		r.AddImage(repository, tag, Image{})
+	}
+}
+
+// AddImage publishes the images under the given tag, a manifest list is
+// created when more than one image is given. The digest of the manifest
+// is returned.
+func (r *Registry) AddImage(repository, tag string, images ...Image) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(images) == 0 {
+		images = []Image{Image{}}
+	}
+
+	digests := []string{}
+	for _, image := range images {
+		digests = append(digests, r.addImageManifest(image))
+	}
+
+	digest := digests[0]
+	if len(images) > 1 {
+		type descriptor struct {
+			MediaType string            `json:"mediaType"`
+			Digest    string            `json:"digest"`
+			Size      int               `json:"size"`
+			Platform  map[string]string `json:"platform"`
+		}
+		list := struct {
+			SchemaVersion int          `json:"schemaVersion"`
+			MediaType     string       `json:"mediaType"`
+			Manifests     []descriptor `json:"manifests"`
+		}{SchemaVersion: 2, MediaType: MediaTypeManifestList}
+
+		for i, image := range images {
+			list.Manifests = append(list.Manifests, descriptor{
+				MediaType: MediaTypeManifest,
+				Digest:    digests[i],
+				Size:      len(r.contents[digests[i]].data),
+				Platform:  platform(image.Platform),
+			})
+		}
+		digest = r.store(MediaTypeManifestList, list)
+	}
+
+	if r.tags[repository] == nil {
+		r.tags[repository] = map[string]string{}
+	}
+	r.tags[repository][tag] = digest
+
+	return digest
+}
+
+// RemoveTag deletes the tag from the repository
+func (r *Registry) RemoveTag(repository, tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.tags[repository], tag)
+}
+
+// RequireAuth protects the registry using the docker token
+// authentication: tokens are issued by the `/token` realm to the
+// clients presenting the given credentials
+func (r *Registry) RequireAuth(username, password string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.username = username
+	r.password = password
+}
+
+// Fail makes the requests whose path starts with the given prefix
+// fail, e.g. `/v2/team/app/tags/list`. When the prefixes of several
+// failures match a request, the longest one wins.
+func (r *Registry) Fail(pathPrefix string, failure Failure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures[pathPrefix] = &failure
+}
+
+// Requests returns the number of requests received whose path starts
+// with the given prefix
+func (r *Registry) Requests(pathPrefix string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, request := range r.requests {
+		if strings.HasPrefix(request[strings.Index(request, " ")+1:], pathPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Registry) addImageManifest(image Image) string {
+	p := platform(image.Platform)
+	imageConfig := map[string]interface{}{
+		"os":           p["os"],
+		"architecture": p["architecture"],
+		"config": map[string]interface{}{
+			"Labels": image.Labels,
+		},
+	}
+	if p["variant"] != "" {
+		imageConfig["variant"] = p["variant"]
+	}
+	if !image.Created.IsZero() {
+		imageConfig["created"] = image.Created.UTC().Format(time.RFC3339Nano)
+	}
+	configDigest := r.store(MediaTypeImageConfig, imageConfig)
+
+	return r.store(MediaTypeManifest, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeManifest,
+		"config": map[string]interface{}{
+			"mediaType": MediaTypeImageConfig,
+			"digest":    configDigest,
+			"size":      len(r.contents[configDigest].data),
+		},
+		"layers": []interface{}{},
+	})
+}
+
+// store saves the JSON encoded object and returns its digest
+func (r *Registry) store(mediaType string, object interface{}) string {
+	data, err := json.Marshal(object)
+	if err != nil {
+		panic(err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	r.contents[digest] = content{mediaType: mediaType, data: data}
+	return digest
+}
+
+func platform(p string) map[string]string {
+	if p == "" {
+		p = DefaultPlatform
+	}
+	parts := strings.SplitN(p, "/", 3)
+	result := map[string]string{"os": parts[0]}
+	if len(parts) > 1 {
+		result["architecture"] = parts[1]
+	}
+	if len(parts) > 2 {
+		result["variant"] = parts[2]
+	}
+	return result
+}
+
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	if failure := r.failure(req.URL.Path); failure != nil {
+		if failure.Times > 0 {
+			failure.Times--
+		}
+		for key, values := range failure.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(failure.StatusCode)
+		return
+	}
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	match := repositoryPathRegexp.FindStringSubmatch(req.URL.Path)
+	scope := "registry:catalog:*"
+	if match != nil {
+		scope = fmt.Sprintf("repository:%s:pull", match[1])
+	}
+	if !r.authorized(req) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+			`Bearer realm="%s/token",service="registrytest",scope="%s"`,
+			r.Server.URL,
+			scope))
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/v2/":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	case req.URL.Path == "/v2/_catalog":
+		repositories := []string{}
+		for repository := range r.tags {
+			repositories = append(repositories, repository)
+		}
+		writeList(w, req, "repositories", repositories)
+	case match == nil:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown endpoint")
+	case match[2] == "tags/list":
+		tags, found := r.tags[match[1]]
+		if !found {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+			return
+		}
+		names := []string{}
+		for tag := range tags {
+			names = append(names, tag)
+		}
+		writeList(w, req, "tags", names)
+	case strings.HasPrefix(match[2], "manifests/"):
+		ref := strings.TrimPrefix(match[2], "manifests/")
+		digest := ref
+		if !strings.HasPrefix(ref, "sha256:") {
+			digest = r.tags[match[1]][ref]
+		}
+		c, found := r.contents[digest]
+		if !found || c.mediaType == MediaTypeImageConfig {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		writeContent(w, req, c)
+	default:
+		digest := strings.TrimPrefix(match[2], "blobs/")
+		c, found := r.contents[digest]
+		if !found || c.mediaType != MediaTypeImageConfig {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		writeContent(w, req, c)
+	}
+}
+
+// failure returns the pending failure with the longest prefix
+// matching the path, nil when there's none
+func (r *Registry) failure(path string) *Failure {
+	var found *Failure
+	longest := -1
+	for prefix, failure := range r.failures {
+		if !strings.HasPrefix(path, prefix) || failure.Times == 0 {
+			continue
+		}
+		if len(prefix) > longest {
+			longest = len(prefix)
+			found = failure
+		}
+	}
+	return found
+}
+
+// authorized returns true when the request carries a token issued by
+// the registry, or when no authentication is required
+func (r *Registry) authorized(req *http.Request) bool {
+	if r.username == "" && r.password == "" {
+		return true
+	}
+	return r.tokens[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+}
+
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	username, password, _ := req.BasicAuth()
+	if username != r.username || password != r.password {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+
+	token := fmt.Sprintf("token-%d", len(r.tokens)+1)
+	r.tokens[token] = true
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_in": 300,
+		"issued_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// writeList writes a paginated list, honoring the `n` and `last`
+// parameters and linking the next page using the `Link` header
+func writeList(w http.ResponseWriter, req *http.Request, key string, items []string) {
+	sort.Strings(items)
+
+	if last := req.URL.Query().Get("last"); last != "" {
+		start := sort.SearchStrings(items, last)
+		if start < len(items) && items[start] == last {
+			start++
+		}
+		items = items[start:]
+	}
+	if n, err := strconv.Atoi(req.URL.Query().Get("n")); err == nil && n > 0 && n < len(items) {
+		items = items[:n]
+		q := url.Values{}
+		q.Set("n", strconv.Itoa(n))
+		q.Set("last", items[n-1])
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, req.URL.Path, q.Encode()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{key: items})
+}
+
+func writeContent(w http.ResponseWriter, req *http.Request, c content) {
+	w.Header().Set("Content-Type", c.mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(c.data)))
+	if req.Method == http.MethodHead {
+		return
+	}
+	w.Write(c.data)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	fmt.Fprintf(w, `{"errors": [{"code": %q, "message": %q}]}`, code, message)
+}
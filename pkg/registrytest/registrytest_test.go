@@ -0,0 +1,237 @@
+package registrytest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, method, url string, header http.Header) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestConfig(t *testing.T) {
+	reg := New()
+	defer reg.Close()
+
+	rc := reg.Config().GetRegistryConfig(reg.Host())
+	if !rc.NonSSL || rc.AuthDomain != reg.Server.URL || rc.MaxBackoffDuration() != time.Millisecond {
+		t.Errorf("Unexpected configuration %+v", rc)
+	}
+}
+
+func TestTagsPagination(t *testing.T) {
+	reg := New()
+	defer reg.Close()
+	reg.AddTags("team/app", "1.0.0", "1.1.0", "2.0.0")
+	reg.RemoveTag("team/app", "1.1.0")
+	reg.AddTags("team/app", "1.2.0")
+
+	tags := []string{}
+	url := reg.Server.URL + "/v2/team/app/tags/list?n=2"
+	for pages := 0; url != ""; pages++ {
+		if pages > 2 {
+			t.Fatalf("Too many pages, got %v", tags)
+		}
+		resp, body := get(t, http.MethodGet, url, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Unexpected status code %d", resp.StatusCode)
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			t.Fatal(err)
+		}
+		tags = append(tags, list.Tags...)
+
+		url = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			url = reg.Server.URL + link[1:len(link)-len(`>; rel="next"`)]
+		}
+	}
+
+	if !reflect.DeepEqual(tags, []string{"1.0.0", "1.2.0", "2.0.0"}) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+
+	resp, _ := get(t, http.MethodGet, reg.Server.URL+"/v2/team/other/tags/list", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected status code %d for an unknown repository", resp.StatusCode)
+	}
+}
+
+func TestManifests(t *testing.T) {
+	reg := New()
+	defer reg.Close()
+	digest := reg.AddImage("team/app", "1.0.0",
+		Image{Platform: "linux/amd64"},
+		Image{Platform: "linux/arm/v7", Labels: map[string]string{"name": "app"}})
+
+	resp, body := get(t, http.MethodHead, reg.Server.URL+"/v2/team/app/manifests/1.0.0", nil)
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Docker-Content-Digest") != digest ||
+		resp.Header.Get("Content-Type") != MediaTypeManifestList ||
+		len(body) != 0 {
+		t.Fatalf("Unexpected HEAD response %d %v %q", resp.StatusCode, resp.Header, body)
+	}
+
+	resp, body = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/manifests/"+digest, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", resp.StatusCode)
+	}
+	var list struct {
+		Manifests []struct {
+			Digest   string            `json:"digest"`
+			Platform map[string]string `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Manifests) != 2 || list.Manifests[1].Platform["variant"] != "v7" {
+		t.Fatalf("Unexpected manifest list %s", body)
+	}
+
+	_, body = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/manifests/"+list.Manifests[1].Digest, nil)
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/blobs/"+manifest.Config.Digest, nil)
+	var imageConfig struct {
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+		Config       struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &imageConfig); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK ||
+		imageConfig.Architecture != "arm" ||
+		imageConfig.Variant != "v7" ||
+		imageConfig.Config.Labels["name"] != "app" {
+		t.Errorf("Unexpected image configuration %s", body)
+	}
+
+	// blobs are not manifests, and the other way around
+	resp, _ = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/manifests/"+manifest.Config.Digest, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected status code %d for a blob fetched as manifest", resp.StatusCode)
+	}
+	resp, _ = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/blobs/"+digest, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected status code %d for a manifest fetched as blob", resp.StatusCode)
+	}
+	resp, _ = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/manifests/2.0.0", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected status code %d for an unknown tag", resp.StatusCode)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	reg := New()
+	defer reg.Close()
+	reg.AddTags("team/app", "1.0.0")
+	reg.RequireAuth("user", "secret")
+
+	resp, _ := get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/tags/list", nil)
+	expected := `Bearer realm="` + reg.Server.URL + `/token",service="registrytest",scope="repository:team/app:pull"`
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != expected {
+		t.Fatalf("Unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, reg.Server.URL+"/token", nil)
+	req.SetBasicAuth("user", "wrong")
+	resp, _ = get(t, http.MethodGet, reg.Server.URL+"/token", req.Header)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Unexpected status code %d for invalid credentials", resp.StatusCode)
+	}
+
+	req.SetBasicAuth("user", "secret")
+	resp, body := get(t, http.MethodGet, reg.Server.URL+"/token", req.Header)
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || resp.StatusCode != http.StatusOK || token.Token == "" {
+		t.Fatalf("Unexpected token response %d %s", resp.StatusCode, body)
+	}
+
+	resp, _ = get(t, http.MethodGet, reg.Server.URL+"/v2/team/app/tags/list",
+		http.Header{"Authorization": []string{"Bearer " + token.Token}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status code %d using the token", resp.StatusCode)
+	}
+}
+
+type FailTestCase struct {
+	Path     string
+	Expected int
+}
+
+func TestFailLongestPrefix(t *testing.T) {
+	reg := New()
+	defer reg.Close()
+	reg.AddTags("team/app", "1.0.0")
+	reg.Fail("/v2/", Failure{StatusCode: http.StatusInternalServerError, Times: -1})
+	reg.Fail("/v2/team/app/", Failure{StatusCode: http.StatusNotFound, Times: -1})
+	reg.Fail("/v2/team/app/tags/list", Failure{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"1"}},
+		Times:      2,
+	})
+
+	// the order of the prefixes must not matter
+	testCases := []FailTestCase{
+		FailTestCase{Path: "/v2/team/app/tags/list", Expected: http.StatusTooManyRequests},
+		FailTestCase{Path: "/v2/team/app/tags/list", Expected: http.StatusTooManyRequests},
+		// exhausted, the next longest prefix is used
+		FailTestCase{Path: "/v2/team/app/tags/list", Expected: http.StatusNotFound},
+		FailTestCase{Path: "/v2/team/app/manifests/1.0.0", Expected: http.StatusNotFound},
+		FailTestCase{Path: "/v2/team/other/tags/list", Expected: http.StatusInternalServerError},
+		FailTestCase{Path: "/token", Expected: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		resp, _ := get(t, http.MethodGet, reg.Server.URL+tc.Path, nil)
+		if resp.StatusCode != tc.Expected {
+			t.Errorf("Unexpected status code for test case %+v, got %d", tc, resp.StatusCode)
+		}
+		if tc.Expected == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("Unexpected headers for test case %+v, got %v", tc, resp.Header)
+		}
+	}
+
+	if requests := reg.Requests("/v2/team/app/"); requests != 4 {
+		t.Errorf("Unexpected number of requests %d", requests)
+	}
+	if requests := reg.Requests("/"); requests != len(testCases) {
+		t.Errorf("Unexpected number of requests %d", requests)
+	}
+}